@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/liridonrama/grpc-go-course/blog/blogpb"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -21,13 +20,26 @@ func main() {
 	defer cc.Close()
 
 	c := blogpb.NewBlogServiceClient(cc)
+	a := blogpb.NewAuthorServiceClient(cc)
+
+	aRes, err := a.CreateAuthor(context.Background(), &blogpb.CreateAuthorRequest{
+		Author: &blogpb.Author{
+			DisplayName: "Some author",
+		},
+	})
+	if err != nil {
+		log.Panicln("Error while getting response from server", err)
+	}
+
+	fmt.Println("Author has been created:", aRes.GetAuthor())
 
 	req := &blogpb.CreateBlogRequest{
 		Blog: &blogpb.Blog{
-			Id:       "",
-			AuthorId: primitive.NewObjectID().Hex(),
-			Title:    "Some title",
-			Content:  "Some content",
+			Id:            "",
+			AuthorId:      aRes.GetAuthor().GetId(),
+			Title:         "Some title",
+			Content:       "Some *content*",
+			ContentFormat: blogpb.Blog_MARKDOWN,
 		},
 	}
 
@@ -38,6 +50,24 @@ func main() {
 
 	fmt.Println("Blog has been created:", res.GetBlog())
 
+	pRes, err := c.PublishBlog(context.Background(), &blogpb.PublishBlogRequest{
+		BlogId: res.GetBlog().GetId(),
+	})
+	if err != nil {
+		log.Panicln("Error while getting response from server", err)
+	}
+
+	fmt.Println("Blog has been published:", pRes.GetBlog())
+
+	reRes, err := c.RenderBlog(context.Background(), &blogpb.RenderBlogRequest{
+		BlogId: res.GetBlog().GetId(),
+	})
+	if err != nil {
+		log.Panicln("Error while getting response from server", err)
+	}
+
+	fmt.Println("Blog has been rendered:", reRes.GetHtml())
+
 	rBReq := &blogpb.ReadBlogRequest{
 		BlogId: "61cf25475edd00e9eac3ef95",
 	}
@@ -94,4 +124,27 @@ func main() {
 	}
 
 	fmt.Println("All Blogs retrieved")
+
+	// list blogs page by page
+	pageToken := ""
+	for {
+		pRes, err := c.ListBlogPage(context.Background(), &blogpb.ListBlogRequest{
+			PageSize:  2,
+			PageToken: pageToken,
+		})
+		if err != nil {
+			log.Panicln("ListBlogPage — Error while getting response from server", err)
+		}
+
+		for _, blog := range pRes.GetBlogs() {
+			fmt.Println("blog received:", blog)
+		}
+
+		pageToken = pRes.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	fmt.Println("All Blog pages retrieved")
 }
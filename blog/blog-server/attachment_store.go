@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentStore keeps the content of blog attachments, their metadata is
+// part of the blog they belong to. Attachments are always addressed together
+// with their blog.
+type AttachmentStore interface {
+	// Put stores the content read from r as the attachment with the given id
+	// and returns its size. Nothing is kept when reading r fails.
+	Put(ctx context.Context, blogID, id primitive.ObjectID, filename string, r io.Reader) (int64, error)
+	// Open returns the content of an attachment.
+	Open(ctx context.Context, blogID, id primitive.ObjectID) (io.ReadCloser, error)
+	Delete(ctx context.Context, blogID, id primitive.ObjectID) error
+	// DeleteBlogAttachments removes every attachment of the given blogs.
+	DeleteBlogAttachments(ctx context.Context, blogIDs []primitive.ObjectID) error
+}
+
+type AttachmentItem struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Filename    string             `bson:"filename"`
+	ContentType string             `bson:"contentType"`
+	Size        int64              `bson:"size"`
+	CreateTime  time.Time          `bson:"createTime"`
+}
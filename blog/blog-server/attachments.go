@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// maxAttachmentSize is the maximum size of an attachment in bytes.
+	maxAttachmentSize = 10 << 20
+	// maxAttachmentsPerBlog is the maximum number of attachments of a blog.
+	maxAttachmentsPerBlog = 50
+	// attachmentChunkSize is the size of the chunks downloads are sent in.
+	attachmentChunkSize = 64 * 1024
+	// sniffLength is the number of bytes http.DetectContentType looks at.
+	sniffLength = 512
+)
+
+// attachmentTypes are the content types attachments may have. Types that can
+// carry scripts, like svg, are left out on purpose.
+var attachmentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func (s *server) UploadAttachment(rStream blogpb.BlogService_UploadAttachmentServer) error {
+	log.Println("Upload Attachment Request RPC Call")
+
+	ctx := rStream.Context()
+
+	req, err := rStream.Recv()
+	if err == io.EOF {
+		return invalidField("metadata", "an upload must start with the metadata of the attachment")
+	}
+	if err != nil {
+		return err
+	}
+
+	// client streams are not covered by the validation interceptor, see
+	// validationStreamInterceptor
+	err = validateRequest(req)
+	if err != nil {
+		return err
+	}
+
+	meta := req.GetMetadata()
+	if meta == nil {
+		return invalidField("metadata", "an upload must start with the metadata of the attachment")
+	}
+
+	blogId, err := primitive.ObjectIDFromHex(meta.GetBlogId())
+	if err != nil {
+		return invalidField("metadata.blog_id", "the provided blog id: %v is not a objectid string", meta.GetBlogId())
+	}
+
+	contentType, _, err := mime.ParseMediaType(meta.GetContentType())
+	if err != nil || !attachmentTypes[contentType] {
+		return invalidField("metadata.content_type", "unsupported content type: %v", meta.GetContentType())
+	}
+
+	// fail early instead of after receiving the whole upload, addAttachment
+	// checks again
+	blog, err := s.attachmentBlog(ctx, blogId)
+	if err != nil {
+		return err
+	}
+	if len(blog.Attachments) >= maxAttachmentsPerBlog {
+		return tooManyAttachments(blog)
+	}
+
+	content := &chunkReader{stream: rStream}
+
+	head := make([]byte, sniffLength)
+
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return storeError(err, "attachment", "")
+	}
+	if n == 0 {
+		return invalidField("chunk", "the attachment must not be empty")
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if sniffed != contentType {
+		return invalidField("metadata.content_type", "the content of the attachment is %v, not %v", sniffed, contentType)
+	}
+
+	attachment := AttachmentItem{
+		ID:          primitive.NewObjectID(),
+		Filename:    meta.GetFilename(),
+		ContentType: contentType,
+		CreateTime:  timeNow(),
+	}
+
+	attachment.Size, err = s.attachments.Put(ctx, blogId, attachment.ID, attachment.Filename, io.MultiReader(bytes.NewReader(head[:n]), content))
+	if err != nil {
+		return storeError(err, "attachment", attachment.ID.Hex())
+	}
+
+	result, err := s.addAttachment(ctx, blogId, attachment)
+	if err != nil {
+		// the content is useless without a blog referring to it
+		delErr := s.attachments.Delete(ctx, blogId, attachment.ID)
+		if delErr != nil {
+			log.Printf("Error while removing attachment %v of blog %v: %v", attachment.ID.Hex(), blogId.Hex(), delErr)
+		}
+
+		return storeError(err, "blog", blogId.Hex())
+	}
+
+	s.recordRevision(ctx, RevisionUpdate, result.Before, result.Blog, 0)
+
+	return rStream.SendAndClose(&blogpb.UploadAttachmentResponse{
+		Attachment: attachmentItemToBlogpb(attachment),
+		Blog:       blogItemToBlogpb(result.Blog),
+	})
+}
+
+// attachmentBlog returns the blog with the given id if it exists, is visible
+// to the caller and is not deleted.
+func (s *server) attachmentBlog(ctx context.Context, id primitive.ObjectID) (BlogItem, error) {
+	blog, err := s.store.Get(ctx, id)
+	if err == nil && (blog.deleted() || !blog.visibleTo(viewerID(ctx))) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		return BlogItem{}, storeError(err, "blog", id.Hex())
+	}
+
+	return blog, nil
+}
+
+func tooManyAttachments(blog BlogItem) error {
+	return errorWithInfo(codes.FailedPrecondition, "TOO_MANY_ATTACHMENTS", "blog", blog.ID.Hex(), "Blog with the id: %v already has %v attachments", blog.ID.Hex(), maxAttachmentsPerBlog)
+}
+
+// addAttachmentAttempts is the number of times adding an attachment to a blog
+// is tried while the blog keeps changing concurrently.
+const addAttachmentAttempts = 3
+
+// addAttachment adds attachment to the attachments of a blog, retrying when
+// the blog changes in the meantime.
+func (s *server) addAttachment(ctx context.Context, blogId primitive.ObjectID, attachment AttachmentItem) (UpdateResult, error) {
+	for attempt := 1; ; attempt++ {
+		blog, err := s.attachmentBlog(ctx, blogId)
+		if err != nil {
+			return UpdateResult{}, err
+		}
+		if len(blog.Attachments) >= maxAttachmentsPerBlog {
+			return UpdateResult{}, tooManyAttachments(blog)
+		}
+
+		result, err := s.store.Update(ctx, blogId, BlogUpdate{
+			Blog: BlogItem{
+				Attachments: append(append([]AttachmentItem{}, blog.Attachments...), attachment),
+				UpdateTime:  timeNow(),
+			},
+			Fields:   []string{"attachments", "update_time"},
+			Revision: &blog.Revision,
+		})
+		if err != errBlogRevisionMismatch || attempt == addAttachmentAttempts {
+			return result, err
+		}
+	}
+}
+
+func (s *server) DownloadAttachment(req *blogpb.DownloadAttachmentRequest, wStream blogpb.BlogService_DownloadAttachmentServer) error {
+	log.Println("Download Attachment Request RPC Call")
+
+	ctx := wStream.Context()
+
+	blogId, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return invalidField("blog_id", "the provided id: %v is not a objectid string", req.GetBlogId())
+	}
+
+	attachmentId, err := primitive.ObjectIDFromHex(req.GetAttachmentId())
+	if err != nil {
+		return invalidField("attachment_id", "the provided id: %v is not a objectid string", req.GetAttachmentId())
+	}
+
+	blog, err := s.attachmentBlog(ctx, blogId)
+	if err != nil {
+		return err
+	}
+
+	var attachment *AttachmentItem
+	for i := range blog.Attachments {
+		if blog.Attachments[i].ID == attachmentId {
+			attachment = &blog.Attachments[i]
+		}
+	}
+	if attachment == nil {
+		return storeError(errAttachmentNotFound, "attachment", req.GetAttachmentId())
+	}
+
+	content, err := s.attachments.Open(ctx, blogId, attachmentId)
+	if err != nil {
+		return storeError(err, "attachment", req.GetAttachmentId())
+	}
+	defer content.Close()
+
+	err = wStream.Send(&blogpb.DownloadAttachmentResponse{
+		Data: &blogpb.DownloadAttachmentResponse_Attachment{Attachment: attachmentItemToBlogpb(*attachment)},
+	})
+	if err != nil {
+		return err
+	}
+
+	chunk := make([]byte, attachmentChunkSize)
+
+	for {
+		n, err := content.Read(chunk)
+		if n > 0 {
+			sendErr := wStream.Send(&blogpb.DownloadAttachmentResponse{
+				Data: &blogpb.DownloadAttachmentResponse_Chunk{Chunk: chunk[:n]},
+			})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return storeError(err, "attachment", req.GetAttachmentId())
+		}
+	}
+}
+
+func attachmentItemToBlogpb(aI AttachmentItem) *blogpb.Attachment {
+	return &blogpb.Attachment{
+		Id:          aI.ID.Hex(),
+		Filename:    aI.Filename,
+		ContentType: aI.ContentType,
+		Size:        aI.Size,
+		CreateTime:  timestamppb.New(aI.CreateTime),
+	}
+}
+
+// chunkReader reads the content of an upload from the chunks following its
+// metadata, failing once it exceeds maxAttachmentSize.
+type chunkReader struct {
+	stream blogpb.BlogService_UploadAttachmentServer
+	chunk  []byte
+	size   int64
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	// never return without data before the end, readers like GridFS take
+	// that as the end of the content
+	for len(c.chunk) == 0 {
+		req, err := c.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, ok := req.GetData().(*blogpb.UploadAttachmentRequest_Chunk); !ok {
+			return 0, invalidField("metadata", "only the first message of an upload carries metadata")
+		}
+
+		c.chunk = req.GetChunk()
+		c.size += int64(len(c.chunk))
+
+		if c.size > maxAttachmentSize {
+			return 0, invalidField("chunk", "the attachment is larger than %v bytes", maxAttachmentSize)
+		}
+	}
+
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errAuthorNotFound = errors.New("author not found")
+	// errAuthorEmailTaken is returned when an author is given the email of
+	// another author.
+	errAuthorEmailTaken = errors.New("author email already in use")
+)
+
+// AuthorStore is the persistence layer of the author service.
+type AuthorStore interface {
+	CreateAuthor(ctx context.Context, author AuthorItem) (AuthorItem, error)
+	GetAuthor(ctx context.Context, id primitive.ObjectID) (AuthorItem, error)
+	// ListAuthors returns at most limit authors in ascending id order starting
+	// after the author with id after.
+	ListAuthors(ctx context.Context, after primitive.ObjectID, limit int64) ([]AuthorItem, error)
+	// UpdateAuthor copies the fields, named as in authorFields, from author
+	// to the stored author with the given id and returns the result.
+	UpdateAuthor(ctx context.Context, id primitive.ObjectID, author AuthorItem, fields []string) (AuthorItem, error)
+}
+
+type AuthorItem struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	DisplayName string             `bson:"displayName"`
+	Email       string             `bson:"email,omitempty"`
+	Bio         string             `bson:"bio,omitempty"`
+	CreateTime  time.Time          `bson:"createTime"`
+	UpdateTime  time.Time          `bson:"updateTime"`
+}
+
+// authorFields describes the fields of an author an update can overwrite,
+// keyed by their proto field name.
+var authorFields = map[string]authorField{
+	"display_name": {
+		key: "displayName",
+		get: func(a AuthorItem) interface{} { return a.DisplayName },
+		set: func(dst *AuthorItem, src AuthorItem) { dst.DisplayName = src.DisplayName },
+	},
+	"email": {
+		key: "email",
+		get: func(a AuthorItem) interface{} { return a.Email },
+		set: func(dst *AuthorItem, src AuthorItem) { dst.Email = src.Email },
+	},
+	"bio": {
+		key: "bio",
+		get: func(a AuthorItem) interface{} { return a.Bio },
+		set: func(dst *AuthorItem, src AuthorItem) { dst.Bio = src.Bio },
+	},
+	"update_time": {
+		key: "updateTime",
+		get: func(a AuthorItem) interface{} { return a.UpdateTime },
+		set: func(dst *AuthorItem, src AuthorItem) { dst.UpdateTime = src.UpdateTime },
+	},
+}
+
+type authorField struct {
+	key string
+	get func(AuthorItem) interface{}
+	set func(dst *AuthorItem, src AuthorItem)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const maxDisplayNameLength = 100
+
+// mutableAuthorFields are the author fields clients may list in an update
+// mask.
+var mutableAuthorFields = []string{"display_name", "email", "bio"}
+
+type authorServer struct {
+	blogpb.UnimplementedAuthorServiceServer
+
+	authors AuthorStore
+}
+
+func (s *authorServer) CreateAuthor(ctx context.Context, req *blogpb.CreateAuthorRequest) (*blogpb.CreateAuthorResponse, error) {
+	log.Println("Create Author Request RPC Call")
+
+	author := req.GetAuthor()
+
+	data, err := authorItem(author, mutableAuthorFields)
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	data.ID = primitive.NewObjectID()
+	data.CreateTime = now
+	data.UpdateTime = now
+
+	created, err := s.authors.CreateAuthor(ctx, data)
+	if err != nil {
+		return nil, storeError(err, "author", data.ID.Hex())
+	}
+
+	res := &blogpb.CreateAuthorResponse{
+		Author: authorItemToBlogpb(created),
+	}
+
+	return res, nil
+}
+
+func (s *authorServer) GetAuthor(ctx context.Context, req *blogpb.GetAuthorRequest) (*blogpb.GetAuthorResponse, error) {
+	log.Println("Get Author Request RPC Call")
+
+	id := req.GetAuthorId()
+
+	authorId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidField("author_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	author, err := s.authors.GetAuthor(ctx, authorId)
+	if err != nil {
+		return nil, storeError(err, "author", id)
+	}
+
+	res := &blogpb.GetAuthorResponse{
+		Author: authorItemToBlogpb(author),
+	}
+
+	return res, nil
+}
+
+func (s *authorServer) ListAuthors(ctx context.Context, req *blogpb.ListAuthorsRequest) (*blogpb.ListAuthorsResponse, error) {
+	log.Println("List Authors Request RPC Call")
+
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return nil, invalidField("page_size", "page size must not be negative: %v", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	after, err := decodeIDPageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch one extra author to find out whether there is a next page
+	authors, err := s.authors.ListAuthors(ctx, after, int64(pageSize)+1)
+	if err != nil {
+		return nil, storeError(err, "author", "")
+	}
+
+	res := &blogpb.ListAuthorsResponse{}
+
+	if len(authors) > int(pageSize) {
+		authors = authors[:pageSize]
+		res.NextPageToken = encodeIDPageToken(authors[len(authors)-1].ID)
+	}
+
+	for _, author := range authors {
+		res.Authors = append(res.Authors, authorItemToBlogpb(author))
+	}
+
+	return res, nil
+}
+
+func (s *authorServer) UpdateAuthor(ctx context.Context, req *blogpb.UpdateAuthorRequest) (*blogpb.UpdateAuthorResponse, error) {
+	log.Println("Update Author Request RPC Call")
+
+	author := req.GetAuthor()
+
+	authorId, err := primitive.ObjectIDFromHex(author.GetId())
+	if err != nil {
+		return nil, invalidField("author.id", "the provided id: %v is not a objectid string", author.GetId())
+	}
+
+	fields, err := updateAuthorFields(author, req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := authorItem(author, fields)
+	if err != nil {
+		return nil, err
+	}
+	data.UpdateTime = timeNow()
+
+	data, err = s.authors.UpdateAuthor(ctx, authorId, data, append(fields, "update_time"))
+	if err != nil {
+		return nil, storeError(err, "author", author.GetId())
+	}
+
+	res := &blogpb.UpdateAuthorResponse{
+		Author: authorItemToBlogpb(data),
+	}
+
+	return res, nil
+}
+
+// authorItem validates the given fields of an author sent by a client and
+// returns them as an AuthorItem.
+func authorItem(author *blogpb.Author, fields []string) (AuthorItem, error) {
+	data := AuthorItem{
+		DisplayName: strings.TrimSpace(author.GetDisplayName()),
+		Bio:         author.GetBio(),
+	}
+
+	if containsString(fields, "display_name") {
+		if data.DisplayName == "" {
+			return AuthorItem{}, invalidField("author.display_name", "the display name of an author must not be empty")
+		}
+
+		if utf8.RuneCountInString(data.DisplayName) > maxDisplayNameLength {
+			return AuthorItem{}, invalidField("author.display_name", "the display name of an author must not be longer than %v characters", maxDisplayNameLength)
+		}
+	}
+
+	if containsString(fields, "email") && author.GetEmail() != "" {
+		address, err := mail.ParseAddress(author.GetEmail())
+		if err != nil || address.Name != "" {
+			return AuthorItem{}, invalidField("author.email", "the provided email: %v is not a valid email address", author.GetEmail())
+		}
+
+		data.Email = strings.ToLower(address.Address)
+	}
+
+	return data, nil
+}
+
+// updateAuthorFields is updateFields for authors.
+func updateAuthorFields(author *blogpb.Author, mask *fieldmaskpb.FieldMask) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		var fields []string
+
+		if author.GetDisplayName() != "" {
+			fields = append(fields, "display_name")
+		}
+
+		if author.GetEmail() != "" {
+			fields = append(fields, "email")
+		}
+
+		if author.GetBio() != "" {
+			fields = append(fields, "bio")
+		}
+
+		return fields, nil
+	}
+
+	var fields []string
+
+	for _, path := range mask.GetPaths() {
+		if !containsString(mutableAuthorFields, path) {
+			return nil, invalidField("update_mask", "invalid update mask path: %q, expected one of %v", path, mutableAuthorFields)
+		}
+
+		if !containsString(fields, path) {
+			fields = append(fields, path)
+		}
+	}
+
+	return fields, nil
+}
+
+func authorItemToBlogpb(aI AuthorItem) *blogpb.Author {
+	return &blogpb.Author{
+		Id:          aI.ID.Hex(),
+		DisplayName: aI.DisplayName,
+		Email:       aI.Email,
+		Bio:         aI.Bio,
+		CreateTime:  timestamppb.New(aI.CreateTime),
+		UpdateTime:  timestamppb.New(aI.UpdateTime),
+	}
+}
+
+// checkAuthor makes sure a blog refers to an existing author.
+func (s *server) checkAuthor(ctx context.Context, authorId primitive.ObjectID) error {
+	_, err := s.authors.GetAuthor(ctx, authorId)
+	if err == errAuthorNotFound {
+		return errorWithInfo(codes.FailedPrecondition, "AUTHOR_NOT_FOUND", "author", authorId.Hex(), "Author with the id: %v does not exist", authorId.Hex())
+	}
+	if err != nil {
+		return storeError(err, "author", authorId.Hex())
+	}
+
+	return nil
+}
+
+// authorChecker returns checkAuthor for calls writing many blogs, which
+// looks up every author only once.
+func (s *server) authorChecker(ctx context.Context) func(primitive.ObjectID) error {
+	checked := make(map[primitive.ObjectID]error)
+
+	return func(authorId primitive.ObjectID) error {
+		err, ok := checked[authorId]
+		if !ok {
+			err = s.checkAuthor(ctx, authorId)
+			checked[authorId] = err
+		}
+
+		return err
+	}
+}
+
+// authorSummary returns the summary of the author of a blog, nil if the
+// author does not exist.
+func (s *server) authorSummary(ctx context.Context, authorId primitive.ObjectID) (*blogpb.AuthorSummary, error) {
+	author, err := s.authors.GetAuthor(ctx, authorId)
+	if err == errAuthorNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &blogpb.AuthorSummary{
+		Id:          author.ID.Hex(),
+		DisplayName: author.DisplayName,
+	}, nil
+}
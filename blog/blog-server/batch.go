@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBatchSize is the maximum number of items of a single batch call.
+const maxBatchSize = 1000
+
+// checkBatchSize backs up the item count rules of the batch requests.
+func checkBatchSize(field string, size int) error {
+	if size == 0 {
+		return invalidField(field, "the batch must contain at least one item")
+	}
+
+	if size > maxBatchSize {
+		return invalidField(field, "the batch contains %v items, at most %v are allowed", size, maxBatchSize)
+	}
+
+	return nil
+}
+
+func okResult(blog BlogItem) *blogpb.BlogResult {
+	return &blogpb.BlogResult{
+		Status: status.New(codes.OK, "").Proto(),
+		Blog:   blogItemToBlogpb(blog),
+	}
+}
+
+func errorResult(err error) *blogpb.BlogResult {
+	return &blogpb.BlogResult{
+		Status: status.Convert(err).Proto(),
+	}
+}
+
+// parseBlogIds parses the ids of a batch call. Invalid ids are reported in
+// the returned results, which are nil for the valid ones.
+func parseBlogIds(ids []string) ([]primitive.ObjectID, []*blogpb.BlogResult) {
+	blogIds := make([]primitive.ObjectID, len(ids))
+	results := make([]*blogpb.BlogResult, len(ids))
+
+	for i, id := range ids {
+		blogId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			results[i] = errorResult(invalidField(fmt.Sprintf("blog_ids[%v]", i), "the provided id: %v is not a objectid string", id))
+			continue
+		}
+
+		blogIds[i] = blogId
+	}
+
+	return blogIds, results
+}
+
+// firstFailure returns the first failed result as an error, for batches that
+// are all or nothing.
+func firstFailure(results []*blogpb.BlogResult) error {
+	for i, result := range results {
+		if result != nil && result.GetStatus().GetCode() != int32(codes.OK) {
+			return status.Errorf(codes.Code(result.GetStatus().GetCode()), "item %v: %v", i, result.GetStatus().GetMessage())
+		}
+	}
+
+	return nil
+}
+
+func (s *server) BatchCreateBlogs(ctx context.Context, req *blogpb.BatchCreateBlogsRequest) (*blogpb.BatchCreateBlogsResponse, error) {
+	log.Println("Batch Create Blogs Request RPC Call")
+
+	err := checkBatchSize("blogs", len(req.GetBlogs()))
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	checkAuthor := s.authorChecker(ctx)
+	results := make([]*blogpb.BlogResult, len(req.GetBlogs()))
+
+	var blogs []BlogItem
+	var positions []int
+
+	for i, blog := range req.GetBlogs() {
+		data, err := newBlogItem(blog, now)
+		if err == nil {
+			err = checkAuthor(data.AuthorID)
+		}
+		if err != nil {
+			results[i] = errorResult(err)
+			continue
+		}
+
+		blogs = append(blogs, data)
+		positions = append(positions, i)
+	}
+
+	if req.GetAllOrNothing() {
+		err = firstFailure(results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	errs, err := s.createBlogs(ctx, blogs, req.GetAllOrNothing())
+	if err == errBatchAborted {
+		for j, blogErr := range errs {
+			if blogErr != nil {
+				return nil, errorWithInfo(codes.Aborted, "BATCH_ABORTED", "blog", blogs[j].ID.Hex(), "item %v: %v, no blog was created", positions[j], status.Convert(storeError(blogErr, "blog", blogs[j].ID.Hex())).Message())
+			}
+		}
+	}
+	if err != nil {
+		return nil, storeError(err, "blog", "")
+	}
+
+	for j, blog := range blogs {
+		if errs[j] != nil {
+			results[positions[j]] = errorResult(storeError(errs[j], "blog", blog.ID.Hex()))
+			continue
+		}
+
+		s.recordRevision(ctx, RevisionCreate, BlogItem{}, blog, 0)
+		results[positions[j]] = okResult(blog)
+	}
+
+	return &blogpb.BatchCreateBlogsResponse{Results: results}, nil
+}
+
+func (s *server) BatchGetBlogs(ctx context.Context, req *blogpb.BatchGetBlogsRequest) (*blogpb.BatchGetBlogsResponse, error) {
+	log.Println("Batch Get Blogs Request RPC Call")
+
+	err := checkBatchSize("blog_ids", len(req.GetBlogIds()))
+	if err != nil {
+		return nil, err
+	}
+
+	blogIds, results := parseBlogIds(req.GetBlogIds())
+
+	blogs, err := s.store.GetMany(ctx, blogIds)
+	if err != nil {
+		return nil, storeError(err, "blog", "")
+	}
+
+	viewer := viewerID(ctx)
+
+	for i, blogId := range blogIds {
+		if results[i] != nil {
+			continue
+		}
+
+		blog, ok := blogs[blogId]
+		if !ok || (blog.deleted() && !req.GetShowDeleted()) || !blog.visibleTo(viewer) {
+			results[i] = errorResult(storeError(errBlogNotFound, "blog", req.GetBlogIds()[i]))
+			continue
+		}
+
+		results[i] = okResult(blog)
+	}
+
+	if req.GetAllOrNothing() {
+		err = firstFailure(results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &blogpb.BatchGetBlogsResponse{Results: results}, nil
+}
+
+func (s *server) BatchDeleteBlogs(ctx context.Context, req *blogpb.BatchDeleteBlogsRequest) (*blogpb.BatchDeleteBlogsResponse, error) {
+	log.Println("Batch Delete Blogs Request RPC Call")
+
+	err := checkBatchSize("blog_ids", len(req.GetBlogIds()))
+	if err != nil {
+		return nil, err
+	}
+
+	blogIds, results := parseBlogIds(req.GetBlogIds())
+
+	if req.GetAllOrNothing() {
+		err = firstFailure(results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var valid []primitive.ObjectID
+	for i, blogId := range blogIds {
+		if results[i] == nil {
+			valid = append(valid, blogId)
+		}
+	}
+
+	deleted, err := s.store.DeleteMany(ctx, valid, timeNow(), req.GetAllOrNothing())
+	if err == errBlogNotFound {
+		return nil, errorWithInfo(codes.NotFound, "NOT_FOUND", "blog", "", "not every blog exists, no blog was deleted")
+	}
+	if err != nil {
+		return nil, storeError(err, "blog", "")
+	}
+
+	recorded := make(map[primitive.ObjectID]bool)
+
+	for i, blogId := range blogIds {
+		if results[i] != nil {
+			continue
+		}
+
+		blog, ok := deleted[blogId]
+		if !ok {
+			results[i] = errorResult(storeError(errBlogNotFound, "blog", req.GetBlogIds()[i]))
+			continue
+		}
+
+		// an id listed twice is only deleted once
+		if !recorded[blogId] {
+			s.recordRevision(ctx, RevisionDelete, blog, blog, 0)
+			recorded[blogId] = true
+		}
+
+		results[i] = okResult(blog)
+	}
+
+	return &blogpb.BatchDeleteBlogsResponse{Results: results}, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errCommentNotFound = errors.New("comment not found")
+
+// CommentStore is the persistence layer for the comments of blogs. Comments
+// are always addressed together with the blog they belong to.
+type CommentStore interface {
+	CreateComment(ctx context.Context, comment CommentItem) (CommentItem, error)
+	GetComment(ctx context.Context, blogID, id primitive.ObjectID) (CommentItem, error)
+	// ListComments returns at most limit comments of a blog replying to
+	// parentID, the top level ones for a zero parentID, in ascending id order
+	// starting after the comment with id after.
+	ListComments(ctx context.Context, blogID, parentID, after primitive.ObjectID, limit int64) ([]CommentItem, error)
+	UpdateComment(ctx context.Context, blogID, id primitive.ObjectID, content string, updateTime time.Time) (CommentItem, error)
+	// DeleteComment removes a comment together with all its replies and
+	// returns how many comments were removed.
+	DeleteComment(ctx context.Context, blogID, id primitive.ObjectID) (int64, error)
+	// DeleteBlogComments removes every comment of the given blogs.
+	DeleteBlogComments(ctx context.Context, blogIDs []primitive.ObjectID) error
+}
+
+type CommentItem struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	BlogID     primitive.ObjectID `bson:"blogId"`
+	ParentID   primitive.ObjectID `bson:"parentId,omitempty"`
+	AuthorID   primitive.ObjectID `bson:"authorId"`
+	Content    string             `bson:"content"`
+	CreateTime time.Time          `bson:"createTime"`
+	UpdateTime time.Time          `bson:"updateTime"`
+}
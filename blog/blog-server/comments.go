@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// commentBlog checks that the blog with the given id exists, is visible to the
+// caller and is not deleted, comments of deleted blogs are hidden until they
+// are undeleted.
+func (s *server) commentBlog(ctx context.Context, id string) (primitive.ObjectID, error) {
+	blogId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidField("blog_id", "the provided blog id: %v is not a objectid string", id)
+	}
+
+	blog, err := s.store.Get(ctx, blogId)
+	if err == nil && (blog.deleted() || !blog.visibleTo(viewerID(ctx))) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		return primitive.NilObjectID, storeError(err, "blog", id)
+	}
+
+	return blogId, nil
+}
+
+func (s *server) CreateComment(ctx context.Context, req *blogpb.CreateCommentRequest) (*blogpb.CreateCommentResponse, error) {
+	log.Println("Create Comment Request RPC Call")
+
+	comment := req.GetComment()
+
+	authorId, err := primitive.ObjectIDFromHex(comment.GetAuthorId())
+	if err != nil {
+		return nil, invalidField("comment.author_id", "the provided author id: %v is not a objectid string", comment.GetAuthorId())
+	}
+
+	if strings.TrimSpace(comment.GetContent()) == "" {
+		return nil, invalidField("comment.content", "the content of a comment must not be empty")
+	}
+
+	blogId, err := s.commentBlog(ctx, comment.GetBlogId())
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	data := CommentItem{
+		ID:         primitive.NewObjectID(),
+		BlogID:     blogId,
+		AuthorID:   authorId,
+		Content:    comment.GetContent(),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	if comment.GetParentId() != "" {
+		data.ParentID, err = primitive.ObjectIDFromHex(comment.GetParentId())
+		if err != nil {
+			return nil, invalidField("comment.parent_id", "the provided parent id: %v is not a objectid string", comment.GetParentId())
+		}
+
+		_, err = s.comments.GetComment(ctx, blogId, data.ParentID)
+		if err == errCommentNotFound {
+			return nil, errorWithInfo(codes.FailedPrecondition, "PARENT_NOT_FOUND", "comment", comment.GetParentId(), "Comment with the id: %v not found on blog %v", comment.GetParentId(), comment.GetBlogId())
+		}
+		if err != nil {
+			return nil, storeError(err, "comment", comment.GetParentId())
+		}
+	}
+
+	created, err := s.comments.CreateComment(ctx, data)
+	if err != nil {
+		return nil, storeError(err, "comment", data.ID.Hex())
+	}
+
+	res := &blogpb.CreateCommentResponse{
+		Comment: commentItemToBlogpb(created),
+	}
+
+	return res, nil
+}
+
+func (s *server) ListComments(ctx context.Context, req *blogpb.ListCommentsRequest) (*blogpb.ListCommentsResponse, error) {
+	log.Println("List Comments Request RPC Call")
+
+	blogId, err := s.commentBlog(ctx, req.GetBlogId())
+	if err != nil {
+		return nil, err
+	}
+
+	var parentId primitive.ObjectID
+	if req.GetParentId() != "" {
+		parentId, err = primitive.ObjectIDFromHex(req.GetParentId())
+		if err != nil {
+			return nil, invalidField("parent_id", "the provided parent id: %v is not a objectid string", req.GetParentId())
+		}
+	}
+
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return nil, invalidField("page_size", "page size must not be negative: %v", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	after, err := decodeIDPageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch one extra comment to find out whether there is a next page
+	comments, err := s.comments.ListComments(ctx, blogId, parentId, after, int64(pageSize)+1)
+	if err != nil {
+		return nil, storeError(err, "comment", "")
+	}
+
+	res := &blogpb.ListCommentsResponse{}
+
+	if len(comments) > int(pageSize) {
+		comments = comments[:pageSize]
+		res.NextPageToken = encodeIDPageToken(comments[len(comments)-1].ID)
+	}
+
+	for _, comment := range comments {
+		res.Comments = append(res.Comments, commentItemToBlogpb(comment))
+	}
+
+	return res, nil
+}
+
+func (s *server) UpdateComment(ctx context.Context, req *blogpb.UpdateCommentRequest) (*blogpb.UpdateCommentResponse, error) {
+	log.Println("Update Comment Request RPC Call")
+
+	comment := req.GetComment()
+
+	commentId, err := primitive.ObjectIDFromHex(comment.GetId())
+	if err != nil {
+		return nil, invalidField("comment.id", "the provided id: %v is not a objectid string", comment.GetId())
+	}
+
+	if strings.TrimSpace(comment.GetContent()) == "" {
+		return nil, invalidField("comment.content", "the content of a comment must not be empty")
+	}
+
+	blogId, err := s.commentBlog(ctx, comment.GetBlogId())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.comments.UpdateComment(ctx, blogId, commentId, comment.GetContent(), timeNow())
+	if err != nil {
+		return nil, storeError(err, "comment", comment.GetId())
+	}
+
+	res := &blogpb.UpdateCommentResponse{
+		Comment: commentItemToBlogpb(data),
+	}
+
+	return res, nil
+}
+
+func (s *server) DeleteComment(ctx context.Context, req *blogpb.DeleteCommentRequest) (*blogpb.DeleteCommentResponse, error) {
+	log.Println("Delete Comment Request RPC Call")
+
+	id := req.GetCommentId()
+
+	commentId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidField("comment_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	blogId, err := s.commentBlog(ctx, req.GetBlogId())
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.comments.DeleteComment(ctx, blogId, commentId)
+	if err != nil {
+		return nil, storeError(err, "comment", id)
+	}
+
+	res := &blogpb.DeleteCommentResponse{
+		CommentId:    id,
+		DeletedCount: deleted,
+	}
+
+	return res, nil
+}
+
+func commentItemToBlogpb(cI CommentItem) *blogpb.Comment {
+	comment := &blogpb.Comment{
+		Id:         cI.ID.Hex(),
+		BlogId:     cI.BlogID.Hex(),
+		AuthorId:   cI.AuthorID.Hex(),
+		Content:    cI.Content,
+		CreateTime: timestamppb.New(cI.CreateTime),
+		UpdateTime: timestamppb.New(cI.UpdateTime),
+	}
+
+	if !cI.ParentID.IsZero() {
+		comment.ParentId = cI.ParentID.Hex()
+	}
+
+	return comment
+}
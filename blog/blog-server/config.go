@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/config"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxDatabaseLength keeps the database names of the longest tenants below
+// the 64 bytes mongo allows.
+const maxDatabaseLength = 63 - 1 - 32
+
+// blogConfig holds the settings of the blog server, see the config package
+// for how they are set.
+type blogConfig struct {
+	config.Server
+
+	Store string
+
+	MongoURI       string
+	Database       string
+	ConnectTimeout time.Duration
+	// AutoMigrate applies pending migrations when the server opens a
+	// database, see migrate.
+	AutoMigrate bool
+	// DryRun makes the migrate command only report what it would change.
+	DryRun bool
+
+	TrashRetention   time.Duration
+	PurgeInterval    time.Duration
+	ScheduleInterval time.Duration
+	AttachmentDir    string
+	Tenants          []string
+}
+
+// loadConfig reads the settings of a command of the blog server from args and
+// the environment, whose variables start with BLOG_. The command is empty for
+// serving.
+func loadConfig(command string, args []string) (blogConfig, error) {
+	cfg := blogConfig{
+		Server: config.Server{
+			Address:  ":6543",
+			CertFile: "ssl/server.crt",
+			KeyFile:  "ssl/server.pem",
+		},
+		Store:            "mongo",
+		MongoURI:         "mongodb://localhost:27017",
+		Database:         "grpc-go-course",
+		ConnectTimeout:   20 * time.Second,
+		AutoMigrate:      true,
+		TrashRetention:   30 * 24 * time.Hour,
+		PurgeInterval:    time.Hour,
+		ScheduleInterval: time.Minute,
+		AttachmentDir:    filepath.Join(os.TempDir(), "blog-attachments"),
+	}
+
+	var tenants string
+
+	name := "blog-server"
+	if command != "" {
+		name += " " + command
+	}
+
+	// every command takes all settings, so they can share a settings file
+	settings := config.NewSet(name, "BLOG")
+	cfg.Server.Add(settings)
+	settings.String(&cfg.Store, "store", "storage backend to use: mongo or memory")
+	settings.String(&cfg.MongoURI, "mongo.uri", "mongodb connection string")
+	settings.String(&cfg.Database, "mongo.database", "database of the default tenant, other tenants get it suffixed with their id")
+	settings.Duration(&cfg.ConnectTimeout, "mongo.connect-timeout", "how long connecting to mongodb and preparing a database, on startup or on the first call for its tenant, may take")
+
+	settings.Bool(&cfg.AutoMigrate, "mongo.auto-migrate", "apply pending migrations on startup instead of refusing to serve databases having them")
+
+	switch command {
+	case "":
+	case "migrate":
+		settings.Bool(&cfg.DryRun, "dry-run", "only report what the pending migrations would change")
+	default:
+		return blogConfig{}, fmt.Errorf("unknown command %q, expected migrate", command)
+	}
+
+	settings.Duration(&cfg.TrashRetention, "trash-retention", "how long deleted blogs are kept before they are purged, 0 keeps them forever")
+	settings.Duration(&cfg.PurgeInterval, "purge-interval", "how often to look for deleted blogs to purge")
+	settings.Duration(&cfg.ScheduleInterval, "schedule-interval", "how often to look for scheduled blogs due to be published")
+	settings.String(&cfg.AttachmentDir, "attachment-dir", "directory attachments are kept in when not using mongo, one subdirectory per tenant")
+	settings.String(&tenants, "tenants", "comma separated tenants calls may be made for and migrate migrates, besides the default tenant and the ones registered by an earlier run")
+
+	settings.Check(func() error {
+		if tenants != "" {
+			cfg.Tenants = strings.Split(tenants, ",")
+		}
+
+		return cfg.check()
+	})
+
+	err := settings.Parse(args)
+	if err != nil {
+		return blogConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c *blogConfig) check() error {
+	switch c.Store {
+	case "mongo":
+		err := options.Client().ApplyURI(c.MongoURI).Validate()
+		if err != nil {
+			return fmt.Errorf("invalid mongo.uri: %v", err)
+		}
+
+		if c.Database == "" || len(c.Database) > maxDatabaseLength || strings.ContainsAny(c.Database, `/\. "$`) {
+			return fmt.Errorf("invalid mongo.database %q", c.Database)
+		}
+
+		if c.ConnectTimeout <= 0 {
+			return fmt.Errorf("mongo.connect-timeout must be positive")
+		}
+	case "memory":
+		if c.AttachmentDir == "" {
+			return fmt.Errorf("attachment-dir must not be empty")
+		}
+	default:
+		return fmt.Errorf("unknown store %q, expected mongo or memory", c.Store)
+	}
+
+	if c.TrashRetention < 0 {
+		return fmt.Errorf("trash-retention must not be negative")
+	}
+
+	if c.PurgeInterval <= 0 || c.ScheduleInterval <= 0 {
+		return fmt.Errorf("purge-interval and schedule-interval must be positive")
+	}
+
+	for _, tenant := range c.Tenants {
+		if !tenantPattern.MatchString(tenant) {
+			return fmt.Errorf("invalid tenant %q in tenants", tenant)
+		}
+	}
+
+	return nil
+}
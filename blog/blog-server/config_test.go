@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		env     map[string]string
+		args    []string
+		check   func(cfg blogConfig) bool
+	}{
+		{"defaults", "", nil, nil, func(cfg blogConfig) bool {
+			return cfg.Store == "mongo" && cfg.Database == "grpc-go-course" && cfg.AutoMigrate && cfg.Tenants == nil
+		}},
+		{"tenants", "", map[string]string{"BLOG_TENANTS": "acme,globex"}, nil, func(cfg blogConfig) bool {
+			return len(cfg.Tenants) == 2 && cfg.Tenants[0] == "acme" && cfg.Tenants[1] == "globex"
+		}},
+		{"flag over env", "", map[string]string{"BLOG_PURGE_INTERVAL": "2h"}, []string{"-purge-interval", "3h"}, func(cfg blogConfig) bool {
+			return cfg.PurgeInterval == 3*time.Hour
+		}},
+		{"dry run", "migrate", nil, []string{"-dry-run"}, func(cfg blogConfig) bool {
+			return cfg.DryRun
+		}},
+		{"memory store", "", map[string]string{"BLOG_STORE": "memory", "BLOG_MONGO_URI": "not checked"}, nil, func(cfg blogConfig) bool {
+			return cfg.Store == "memory"
+		}},
+		{"keeping the trash forever", "", map[string]string{"BLOG_TRASH_RETENTION": "0s"}, nil, func(cfg blogConfig) bool {
+			return cfg.TrashRetention == 0
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := loadConfig(tt.command, tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig failed: %v", err)
+			}
+
+			if !tt.check(cfg) {
+				t.Errorf("loadConfig = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		env     map[string]string
+		want    string
+	}{
+		{"unknown command", "serve", nil, `unknown command "serve", expected migrate`},
+		{"unknown store", "", map[string]string{"BLOG_STORE": "postgres"}, `unknown store "postgres", expected mongo or memory`},
+		{"mongo uri", "", map[string]string{"BLOG_MONGO_URI": "http://localhost"}, "invalid mongo.uri: "},
+		{"empty database", "", map[string]string{"BLOG_MONGO_DATABASE": ""}, `invalid mongo.database ""`},
+		{"database with a dot", "", map[string]string{"BLOG_MONGO_DATABASE": "blog.v2"}, `invalid mongo.database "blog.v2"`},
+		{"database too long", "", map[string]string{"BLOG_MONGO_DATABASE": strings.Repeat("b", maxDatabaseLength+1)}, "invalid mongo.database "},
+		{"connect timeout", "", map[string]string{"BLOG_MONGO_CONNECT_TIMEOUT": "0s"}, "mongo.connect-timeout must be positive"},
+		{"attachment dir", "", map[string]string{"BLOG_STORE": "memory", "BLOG_ATTACHMENT_DIR": ""}, "attachment-dir must not be empty"},
+		{"trash retention", "", map[string]string{"BLOG_TRASH_RETENTION": "-1h"}, "trash-retention must not be negative"},
+		{"purge interval", "", map[string]string{"BLOG_PURGE_INTERVAL": "0s"}, "purge-interval and schedule-interval must be positive"},
+		{"schedule interval", "", map[string]string{"BLOG_SCHEDULE_INTERVAL": "-1m"}, "purge-interval and schedule-interval must be positive"},
+		{"tenant", "", map[string]string{"BLOG_TENANTS": "acme,Globex"}, `invalid tenant "Globex" in tenants`},
+		{"empty tenant", "", map[string]string{"BLOG_TENANTS": "acme,,globex"}, `invalid tenant "" in tenants`},
+		{"address", "", map[string]string{"BLOG_ADDRESS": "localhost"}, `invalid address "localhost"`},
+		{"invalid duration", "", map[string]string{"BLOG_PURGE_INTERVAL": "hourly"}, `invalid value "hourly" for purge-interval`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := loadConfig(tt.command, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
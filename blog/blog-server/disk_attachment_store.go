@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// diskAttachmentStore keeps attachments as files on the local disk, one
+// directory per blog.
+type diskAttachmentStore struct {
+	dir string
+}
+
+func newDiskAttachmentStore(dir string) (*diskAttachmentStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskAttachmentStore{dir: dir}, nil
+}
+
+func (d *diskAttachmentStore) path(blogID, id primitive.ObjectID) string {
+	return filepath.Join(d.dir, blogID.Hex(), id.Hex())
+}
+
+func (d *diskAttachmentStore) Put(_ context.Context, blogID, id primitive.ObjectID, _ string, r io.Reader) (int64, error) {
+	blogDir := filepath.Join(d.dir, blogID.Hex())
+
+	err := os.MkdirAll(blogDir, 0o755)
+	if err != nil {
+		return 0, err
+	}
+
+	// write to a temporary file first so a failed upload leaves nothing
+	// behind under the name of the attachment
+	tmp, err := os.CreateTemp(blogDir, ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(tmp.Name(), d.path(blogID, id))
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func (d *diskAttachmentStore) Open(_ context.Context, blogID, id primitive.ObjectID) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(blogID, id))
+	if os.IsNotExist(err) {
+		return nil, errAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (d *diskAttachmentStore) Delete(_ context.Context, blogID, id primitive.ObjectID) error {
+	err := os.Remove(d.path(blogID, id))
+	if os.IsNotExist(err) {
+		return errAttachmentNotFound
+	}
+
+	return err
+}
+
+func (d *diskAttachmentStore) DeleteBlogAttachments(_ context.Context, blogIDs []primitive.ObjectID) error {
+	for _, blogID := range blogIDs {
+		err := os.RemoveAll(filepath.Join(d.dir, blogID.Hex()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
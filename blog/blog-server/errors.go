@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to the errors
+// of the blog server.
+const errorDomain = "blog.grpc-go-course"
+
+// storeErrorStatus is how a store error is reported to clients. Messages are
+// formatted with the resource and id the failed call was about.
+type storeErrorStatus struct {
+	err     error
+	code    codes.Code
+	reason  string
+	message string
+}
+
+var storeErrors = []storeErrorStatus{
+	{errBlogNotFound, codes.NotFound, "NOT_FOUND", "%v with the id: %v not found"},
+	{errCommentNotFound, codes.NotFound, "NOT_FOUND", "%v with the id: %v not found"},
+	{errAuthorNotFound, codes.NotFound, "NOT_FOUND", "%v with the id: %v not found"},
+	{errRevisionNotFound, codes.NotFound, "NOT_FOUND", "%v with the id: %v not found"},
+	{errAttachmentNotFound, codes.NotFound, "NOT_FOUND", "%v with the id: %v not found"},
+	{errBlogRevisionMismatch, codes.Aborted, "ETAG_MISMATCH", "%v with the id: %v was modified concurrently, its etag is stale"},
+	{errBlogExists, codes.AlreadyExists, "ALREADY_EXISTS", "%v with the id: %v already exists"},
+	{errAuthorEmailTaken, codes.AlreadyExists, "EMAIL_TAKEN", "%v with the id: %v can not use an email of another author"},
+	{errSlugTaken, codes.AlreadyExists, "SLUG_TAKEN", "%v with the id: %v can not use a slug of another blog"},
+	{errBlogNotDeleted, codes.FailedPrecondition, "NOT_DELETED", "%v with the id: %v is not deleted"},
+	{errBatchAborted, codes.Aborted, "BATCH_ABORTED", "the batch was aborted, no %[1]v was changed"},
+	{errInvalidResumeToken, codes.InvalidArgument, "INVALID_RESUME_TOKEN", "resume token %[2]v is invalid"},
+	{errResumeTokenExpired, codes.OutOfRange, "RESUME_TOKEN_EXPIRED", "resume token %[2]v is too old, events after it are no longer available"},
+}
+
+// storeError turns an error returned by a store while handling the resource
+// with the given id into a status error carrying an ErrorInfo detail. The id
+// is empty for calls about many resources. Status errors are returned as is.
+//
+// Store sentinels map to the status of storeErrors, driver errors to
+// Canceled, DeadlineExceeded, Unavailable, AlreadyExists or NotFound and
+// anything else to Internal.
+func storeError(err error, resource, id string) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	for _, mapped := range storeErrors {
+		if errors.Is(err, mapped.err) {
+			return errorWithInfo(mapped.code, mapped.reason, resource, id, mapped.message, resource, id)
+		}
+	}
+
+	var selectionErr topology.ServerSelectionError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errorWithInfo(codes.Canceled, "CANCELLED", resource, id, "the request was cancelled")
+	case errors.As(err, &selectionErr), errors.Is(err, mongo.ErrClientDisconnected), mongo.IsNetworkError(err):
+		return errorWithInfo(codes.Unavailable, "DATABASE_UNAVAILABLE", resource, id, "the database is unavailable: %v", err)
+	case mongo.IsTimeout(err):
+		return errorWithInfo(codes.DeadlineExceeded, "DATABASE_TIMEOUT", resource, id, "the database did not answer in time: %v", err)
+	case mongo.IsDuplicateKeyError(err):
+		return errorWithInfo(codes.AlreadyExists, "DUPLICATE_KEY", resource, id, "%v with the id: %v collides with an existing one: %v", resource, id, err)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return errorWithInfo(codes.NotFound, "NOT_FOUND", resource, id, "%v with the id: %v not found", resource, id)
+	default:
+		return errorWithInfo(codes.Internal, "DATABASE_ERROR", resource, id, "database error: %v", err)
+	}
+}
+
+// errorWithInfo returns a status error with an ErrorInfo detail naming the
+// resource and id it is about.
+func errorWithInfo(code codes.Code, reason, resource, id, format string, args ...interface{}) error {
+	st := status.New(code, fmt.Sprintf(format, args...))
+
+	metadata := map[string]string{"resource": resource}
+	if id != "" {
+		metadata["id"] = id
+	}
+
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strconv"
+)
+
+// Etags are the blog revision in quotes, clients are expected to treat them
+// as opaque.
+func formatEtag(revision int64) string {
+	return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// parseEtag returns the revision an etag sent in field was issued for, or nil
+// when no etag was given.
+func parseEtag(field, etag string) (*int64, error) {
+	if etag == "" {
+		return nil, nil
+	}
+
+	unquoted, err := strconv.Unquote(etag)
+	if err != nil {
+		return nil, invalidField(field, "invalid etag: %v", etag)
+	}
+
+	revision, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || revision < 0 {
+		return nil, invalidField(field, "invalid etag: %v", etag)
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errInvalidResumeToken = errors.New("invalid resume token")
+	errResumeTokenExpired = errors.New("resume token expired")
+)
+
+type EventType int
+
+const (
+	EventCreated EventType = iota + 1
+	EventUpdated
+	EventDeleted
+)
+
+var eventTypeToBlogpb = map[EventType]blogpb.BlogEvent_Type{
+	EventCreated: blogpb.BlogEvent_CREATED,
+	EventUpdated: blogpb.BlogEvent_UPDATED,
+	EventDeleted: blogpb.BlogEvent_DELETED,
+}
+
+// BlogEvent is a change to a blog as seen by BlogStore.Watch.
+type BlogEvent struct {
+	Type EventType
+	// Blog is the blog right after the change.
+	Blog BlogItem
+	// ResumeToken can be passed to BlogStore.Watch to continue after this
+	// event.
+	ResumeToken string
+}
+
+// eventBufferSize is the number of past events the in-memory event bus keeps
+// around for watchers that resume.
+const eventBufferSize = 1024
+
+// eventBus is the in-process change feed of the in-memory store.
+type eventBus struct {
+	mu sync.Mutex
+	// seq is the sequence number of the last published event.
+	seq    uint64
+	events []BlogEvent
+	// waiters are woken up whenever an event is published.
+	waiters map[chan struct{}]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		waiters: make(map[chan struct{}]struct{}),
+	}
+}
+
+func (b *eventBus) publish(eventType EventType, blog BlogItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	b.events = append(b.events, BlogEvent{
+		Type:        eventType,
+		Blog:        blog,
+		ResumeToken: encodeSeqToken(b.seq),
+	})
+	if len(b.events) > eventBufferSize {
+		b.events = b.events[len(b.events)-eventBufferSize:]
+	}
+
+	for wake := range b.waiters {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch calls fn for every event published after the one the resume token
+// belongs to, or after now without a token, until ctx is done or fn fails.
+func (b *eventBus) watch(ctx context.Context, resumeToken string, fn func(BlogEvent) error) error {
+	wake := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	cursor := b.seq
+	b.waiters[wake] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.waiters, wake)
+		b.mu.Unlock()
+	}()
+
+	if resumeToken != "" {
+		seq, err := decodeSeqToken(resumeToken)
+		if err != nil {
+			return err
+		}
+
+		if seq > cursor {
+			return errInvalidResumeToken
+		}
+
+		cursor = seq
+	}
+
+	for {
+		events, err := b.since(cursor)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			err = fn(event)
+			if err != nil {
+				return err
+			}
+		}
+		cursor += uint64(len(events))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// since returns the buffered events following the event with sequence number
+// seq.
+func (b *eventBus) since(seq uint64) ([]BlogEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.seq - uint64(len(b.events)) + 1
+	if seq+1 < oldest {
+		return nil, errResumeTokenExpired
+	}
+
+	pending := b.events[len(b.events)-int(b.seq-seq):]
+
+	return append([]BlogEvent(nil), pending...), nil
+}
+
+// The in-memory store uses the event sequence numbers as resume tokens.
+func encodeSeqToken(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(seq, 10)))
+}
+
+func decodeSeqToken(token string) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidResumeToken
+	}
+
+	seq, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, errInvalidResumeToken
+	}
+
+	return seq, nil
+}
+
+func (s *server) WatchBlogs(req *blogpb.WatchBlogsRequest, wStream blogpb.BlogService_WatchBlogsServer) error {
+	log.Println("Watch Blogs Request RPC Call")
+
+	ctx := wStream.Context()
+
+	err := s.store.Watch(ctx, req.GetResumeToken(), viewerID(ctx), func(event BlogEvent) error {
+		return wStream.Send(&blogpb.BlogEvent{
+			Type:        eventTypeToBlogpb[event.Type],
+			Blog:        blogItemToBlogpb(event.Blog),
+			ResumeToken: event.ResumeToken,
+		})
+	})
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if err == errInvalidResumeToken {
+		return invalidField("resume_token", "invalid resume token: %v", req.GetResumeToken())
+	}
+	if err != nil {
+		return storeError(err, "resume_token", req.GetResumeToken())
+	}
+
+	return nil
+}
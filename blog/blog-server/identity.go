@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/metadata"
+)
+
+// userMetadataKey is the request metadata carrying the id of the calling
+// user. There is no authentication in front of the blog service yet, so it
+// is taken at face value.
+const userMetadataKey = "x-user-id"
+
+// callerID returns the id of the calling user, or an empty string for
+// anonymous calls.
+func callerID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(userMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// viewerID is callerID as the viewer of BlogItem.visibleTo, the zero id for
+// anonymous calls and ids that are not object ids.
+func viewerID(ctx context.Context) primitive.ObjectID {
+	viewer, _ := primitive.ObjectIDFromHex(callerID(ctx))
+
+	return viewer
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// importBatchSize is the number of imported blogs written at once.
+	importBatchSize = 500
+	// exportChunkSize is the size export chunks are filled up to.
+	exportChunkSize = 64 * 1024
+)
+
+// importedBlogItem is newBlogItem for imports, which keep the id, state,
+// slug and timestamps of the blog when they are set. Deleted blogs stay
+// deleted.
+func importedBlogItem(blog *blogpb.Blog) (BlogItem, error) {
+	now := timeNow()
+
+	data, err := newBlogItem(blog, now)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	if blog.GetId() != "" {
+		data.ID, err = primitive.ObjectIDFromHex(blog.GetId())
+		if err != nil {
+			return BlogItem{}, invalidField("blog.id", "the provided id: %v is not a objectid string", blog.GetId())
+		}
+	}
+
+	if blog.GetCreateTime() != nil {
+		data.CreateTime = blog.GetCreateTime().AsTime().Truncate(time.Millisecond)
+	}
+
+	if blog.GetUpdateTime() != nil {
+		data.UpdateTime = blog.GetUpdateTime().AsTime().Truncate(time.Millisecond)
+	}
+
+	if blog.GetState() != blogpb.Blog_STATE_UNSPECIFIED {
+		state, ok := blogStateFromBlogpb[blog.GetState()]
+		if !ok {
+			return BlogItem{}, invalidField("blog.state", "unknown blog state: %v", blog.GetState())
+		}
+
+		data.State = state
+	}
+
+	if blog.GetPublishTime() != nil {
+		data.PublishTime = blog.GetPublishTime().AsTime().Truncate(time.Millisecond)
+	}
+
+	if blog.GetDeleteTime() != nil {
+		data.DeleteTime = blog.GetDeleteTime().AsTime().Truncate(time.Millisecond)
+	}
+
+	// kept when free, see slugBase
+	data.Slug = blog.GetSlug()
+
+	return data, nil
+}
+
+func (s *server) ImportBlogs(rStream blogpb.BlogService_ImportBlogsServer) error {
+	log.Println("Import Blogs Request RPC Call")
+
+	ctx := rStream.Context()
+	checkAuthor := s.authorChecker(ctx)
+	res := &blogpb.ImportBlogsResponse{}
+
+	var batch []BlogItem
+	var positions []int64
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		errs, err := s.createBlogs(ctx, batch, false)
+		if err != nil {
+			return storeError(err, "blog", "")
+		}
+
+		for i, blog := range batch {
+			switch {
+			case errs[i] == errBlogExists:
+				res.Skipped++
+			case errs[i] != nil:
+				res.Failures = append(res.Failures, &blogpb.ImportFailure{
+					Index:  positions[i],
+					BlogId: blog.ID.Hex(),
+					Status: status.Convert(storeError(errs[i], "blog", blog.ID.Hex())).Proto(),
+				})
+			default:
+				s.recordRevision(ctx, RevisionCreate, BlogItem{}, blog, 0)
+				res.Inserted++
+			}
+		}
+
+		batch, positions = batch[:0], positions[:0]
+
+		return nil
+	}
+
+	for index := int64(0); ; index++ {
+		req, err := rStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// client streams are not covered by the validation interceptor, see
+		// validationStreamInterceptor
+		var data BlogItem
+
+		err = validateRequest(req)
+		if err == nil {
+			data, err = importedBlogItem(req.GetBlog())
+		}
+		if err == nil {
+			err = checkAuthor(data.AuthorID)
+		}
+		if err != nil {
+			res.Failures = append(res.Failures, &blogpb.ImportFailure{
+				Index:  index,
+				BlogId: req.GetBlog().GetId(),
+				Status: status.Convert(err).Proto(),
+			})
+			continue
+		}
+
+		batch = append(batch, data)
+		positions = append(positions, index)
+
+		if len(batch) == importBatchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		return err
+	}
+
+	return rStream.SendAndClose(res)
+}
+
+func (s *server) ExportBlogs(req *blogpb.ExportBlogsRequest, wStream blogpb.BlogService_ExportBlogsServer) error {
+	log.Println("Export Blogs Request RPC Call")
+
+	if _, ok := blogpb.ExportBlogsRequest_Format_name[int32(req.GetFormat())]; !ok {
+		return invalidField("format", "unknown export format: %v", req.GetFormat())
+	}
+
+	query := ListQuery{}
+	if req.GetShowDeleted() {
+		query.Deleted = ShowDeleted
+	}
+
+	var chunk []byte
+
+	err := s.store.List(wStream.Context(), query, func(blog BlogItem) error {
+		var err error
+
+		chunk, err = appendExportedBlog(chunk, blogItemToBlogpb(blog), req.GetFormat())
+		if err != nil {
+			return err
+		}
+
+		if len(chunk) < exportChunkSize {
+			return nil
+		}
+
+		err = wStream.Send(&blogpb.ExportBlogsResponse{Data: chunk})
+		chunk = nil
+
+		return err
+	})
+	if err != nil {
+		return storeError(err, "blog", "")
+	}
+
+	if len(chunk) > 0 {
+		return wStream.Send(&blogpb.ExportBlogsResponse{Data: chunk})
+	}
+
+	return nil
+}
+
+// appendExportedBlog appends blog encoded in the given export format to b.
+func appendExportedBlog(b []byte, blog *blogpb.Blog, format blogpb.ExportBlogsRequest_Format) ([]byte, error) {
+	switch format {
+	case blogpb.ExportBlogsRequest_PROTO_DELIMITED:
+		raw, err := proto.Marshal(blog)
+		if err != nil {
+			return nil, err
+		}
+
+		b = protowire.AppendVarint(b, uint64(len(raw)))
+
+		return append(b, raw...), nil
+	case blogpb.ExportBlogsRequest_JSON_LINES:
+		raw, err := protojson.Marshal(blog)
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, raw...)
+
+		return append(b, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unknown export format: %v", format)
+	}
+}
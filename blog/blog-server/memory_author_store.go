@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAuthorStore struct {
+	mu      sync.RWMutex
+	authors map[primitive.ObjectID]AuthorItem
+}
+
+func newMemoryAuthorStore() *memoryAuthorStore {
+	return &memoryAuthorStore{
+		authors: make(map[primitive.ObjectID]AuthorItem),
+	}
+}
+
+// emailTaken reports whether an author other than id uses email.
+func (m *memoryAuthorStore) emailTaken(id primitive.ObjectID, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	for _, author := range m.authors {
+		if author.ID != id && author.Email == email {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memoryAuthorStore) CreateAuthor(_ context.Context, author AuthorItem) (AuthorItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(author.ID, author.Email) {
+		return AuthorItem{}, errAuthorEmailTaken
+	}
+
+	m.authors[author.ID] = author
+
+	return author, nil
+}
+
+func (m *memoryAuthorStore) GetAuthor(_ context.Context, id primitive.ObjectID) (AuthorItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	author, ok := m.authors[id]
+	if !ok {
+		return AuthorItem{}, errAuthorNotFound
+	}
+
+	return author, nil
+}
+
+func (m *memoryAuthorStore) ListAuthors(_ context.Context, after primitive.ObjectID, limit int64) ([]AuthorItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var authors []AuthorItem
+	for _, author := range m.authors {
+		if !after.IsZero() && bytes.Compare(author.ID[:], after[:]) <= 0 {
+			continue
+		}
+
+		authors = append(authors, author)
+	}
+
+	sort.Slice(authors, func(i, j int) bool {
+		return bytes.Compare(authors[i].ID[:], authors[j].ID[:]) < 0
+	})
+
+	if limit > 0 && int64(len(authors)) > limit {
+		authors = authors[:limit]
+	}
+
+	return authors, nil
+}
+
+func (m *memoryAuthorStore) UpdateAuthor(_ context.Context, id primitive.ObjectID, author AuthorItem, fields []string) (AuthorItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.authors[id]
+	if !ok {
+		return AuthorItem{}, errAuthorNotFound
+	}
+
+	for _, field := range fields {
+		authorFields[field].set(&stored, author)
+	}
+
+	if m.emailTaken(id, stored.Email) {
+		return AuthorItem{}, errAuthorEmailTaken
+	}
+
+	m.authors[id] = stored
+
+	return stored, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryCommentStore struct {
+	mu       sync.RWMutex
+	comments map[primitive.ObjectID]CommentItem
+}
+
+func newMemoryCommentStore() *memoryCommentStore {
+	return &memoryCommentStore{
+		comments: make(map[primitive.ObjectID]CommentItem),
+	}
+}
+
+func (m *memoryCommentStore) CreateComment(_ context.Context, comment CommentItem) (CommentItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.comments[comment.ID] = comment
+
+	return comment, nil
+}
+
+func (m *memoryCommentStore) GetComment(_ context.Context, blogID, id primitive.ObjectID) (CommentItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comment, ok := m.comments[id]
+	if !ok || comment.BlogID != blogID {
+		return CommentItem{}, errCommentNotFound
+	}
+
+	return comment, nil
+}
+
+func (m *memoryCommentStore) ListComments(_ context.Context, blogID, parentID, after primitive.ObjectID, limit int64) ([]CommentItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var comments []CommentItem
+	for _, comment := range m.comments {
+		if comment.BlogID != blogID || comment.ParentID != parentID {
+			continue
+		}
+
+		if !after.IsZero() && bytes.Compare(comment.ID[:], after[:]) <= 0 {
+			continue
+		}
+
+		comments = append(comments, comment)
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return bytes.Compare(comments[i].ID[:], comments[j].ID[:]) < 0
+	})
+
+	if limit > 0 && int64(len(comments)) > limit {
+		comments = comments[:limit]
+	}
+
+	return comments, nil
+}
+
+func (m *memoryCommentStore) UpdateComment(_ context.Context, blogID, id primitive.ObjectID, content string, updateTime time.Time) (CommentItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[id]
+	if !ok || comment.BlogID != blogID {
+		return CommentItem{}, errCommentNotFound
+	}
+
+	comment.Content = content
+	comment.UpdateTime = updateTime
+	m.comments[id] = comment
+
+	return comment, nil
+}
+
+func (m *memoryCommentStore) DeleteComment(_ context.Context, blogID, id primitive.ObjectID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, ok := m.comments[id]
+	if !ok || comment.BlogID != blogID {
+		return 0, errCommentNotFound
+	}
+
+	var deleted int64
+
+	pending := []primitive.ObjectID{id}
+	for len(pending) > 0 {
+		parentID := pending[0]
+		pending = pending[1:]
+
+		delete(m.comments, parentID)
+		deleted++
+
+		for replyID, reply := range m.comments {
+			if reply.ParentID == parentID {
+				pending = append(pending, replyID)
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *memoryCommentStore) DeleteBlogComments(_ context.Context, blogIDs []primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blogs := make(map[primitive.ObjectID]bool, len(blogIDs))
+	for _, blogID := range blogIDs {
+		blogs[blogID] = true
+	}
+
+	for id, comment := range m.comments {
+		if blogs[comment.BlogID] {
+			delete(m.comments, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryStore struct {
+	mu    sync.RWMutex
+	blogs map[primitive.ObjectID]BlogItem
+	// slugs maps the slug of every blog to its id, like the unique slug
+	// index of the mongo store.
+	slugs map[string]primitive.ObjectID
+	index *invertedIndex
+	// revisions holds the history of every blog, oldest revision first.
+	revisions map[primitive.ObjectID][]BlogRevisionItem
+	events    *eventBus
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		blogs:     make(map[primitive.ObjectID]BlogItem),
+		slugs:     make(map[string]primitive.ObjectID),
+		index:     newInvertedIndex(),
+		revisions: make(map[primitive.ObjectID][]BlogRevisionItem),
+		events:    newEventBus(),
+	}
+}
+
+func (m *memoryStore) Create(_ context.Context, blog BlogItem) (BlogItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.blogs[blog.ID]; ok {
+		return BlogItem{}, errBlogExists
+	}
+
+	if m.slugTaken(blog.Slug, blog.ID) {
+		return BlogItem{}, errSlugTaken
+	}
+
+	m.put(blog)
+	m.index.add(blog)
+	m.events.publish(EventCreated, blog)
+
+	return blog, nil
+}
+
+func (m *memoryStore) CreateMany(_ context.Context, blogs []BlogItem, atomic bool) ([]error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := make([]error, len(blogs))
+	failed := false
+	seen := make(map[primitive.ObjectID]bool)
+	seenSlugs := make(map[string]bool)
+
+	for i, blog := range blogs {
+		if _, ok := m.blogs[blog.ID]; ok || seen[blog.ID] {
+			errs[i] = errBlogExists
+			failed = true
+		} else if m.slugTaken(blog.Slug, blog.ID) || (blog.Slug != "" && seenSlugs[blog.Slug]) {
+			errs[i] = errSlugTaken
+			failed = true
+		}
+		seen[blog.ID] = true
+		seenSlugs[blog.Slug] = true
+	}
+
+	if atomic && failed {
+		return errs, errBatchAborted
+	}
+
+	for i, blog := range blogs {
+		if errs[i] != nil {
+			continue
+		}
+
+		m.put(blog)
+		m.index.add(blog)
+		m.events.publish(EventCreated, blog)
+	}
+
+	return errs, nil
+}
+
+// slugTaken tells whether a blog other than the one with the given id has
+// the slug.
+func (m *memoryStore) slugTaken(slug string, id primitive.ObjectID) bool {
+	owner, ok := m.slugs[slug]
+
+	return slug != "" && ok && owner != id
+}
+
+// put stores blog and keeps the slug index up to date.
+func (m *memoryStore) put(blog BlogItem) {
+	if stored, ok := m.blogs[blog.ID]; ok && stored.Slug != blog.Slug {
+		delete(m.slugs, stored.Slug)
+	}
+
+	if blog.Slug != "" {
+		m.slugs[blog.Slug] = blog.ID
+	}
+
+	m.blogs[blog.ID] = blog
+}
+
+func (m *memoryStore) GetBySlug(_ context.Context, slug string) (BlogItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.slugs[slug]
+	if !ok {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	return m.blogs[id], nil
+}
+
+func (m *memoryStore) Get(_ context.Context, id primitive.ObjectID) (BlogItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	blog, ok := m.blogs[id]
+	if !ok {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	return blog, nil
+}
+
+func (m *memoryStore) GetMany(_ context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]BlogItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	blogs := make(map[primitive.ObjectID]BlogItem)
+	for _, id := range ids {
+		if blog, ok := m.blogs[id]; ok {
+			blogs[id] = blog
+		}
+	}
+
+	return blogs, nil
+}
+
+func (m *memoryStore) Update(_ context.Context, id primitive.ObjectID, update BlogUpdate) (UpdateResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.blogs[id]
+	if ok && stored.deleted() {
+		if update.AllowMissing && update.Revision == nil {
+			return UpdateResult{}, errBlogExists
+		}
+
+		return UpdateResult{}, errBlogNotFound
+	}
+	if !ok && (!update.AllowMissing || update.Revision != nil) {
+		return UpdateResult{}, errBlogNotFound
+	}
+
+	if update.Revision != nil && stored.Revision != *update.Revision {
+		return UpdateResult{}, errBlogRevisionMismatch
+	}
+
+	res := UpdateResult{
+		Before:  stored,
+		Blog:    applyUpdate(id, stored, !ok, update),
+		Created: !ok,
+	}
+
+	if m.slugTaken(res.Blog.Slug, id) {
+		return UpdateResult{}, errSlugTaken
+	}
+
+	m.put(res.Blog)
+	m.index.add(res.Blog)
+
+	if res.Created {
+		m.events.publish(EventCreated, res.Blog)
+	} else {
+		m.events.publish(EventUpdated, res.Blog)
+	}
+
+	return res, nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, id primitive.ObjectID, revision *int64, deleteTime time.Time) (BlogItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.blogs[id]
+	if !ok || stored.deleted() {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	if revision != nil && stored.Revision != *revision {
+		return BlogItem{}, errBlogRevisionMismatch
+	}
+
+	stored.DeleteTime = deleteTime
+	stored.Revision++
+	m.blogs[id] = stored
+	// deleted blogs are not searchable
+	m.index.remove(id)
+	m.events.publish(EventDeleted, stored)
+
+	return stored, nil
+}
+
+func (m *memoryStore) DeleteMany(_ context.Context, ids []primitive.ObjectID, deleteTime time.Time, atomic bool) (map[primitive.ObjectID]BlogItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if atomic {
+		for _, id := range ids {
+			if blog, ok := m.blogs[id]; !ok || blog.deleted() {
+				return nil, errBlogNotFound
+			}
+		}
+	}
+
+	deleted := make(map[primitive.ObjectID]BlogItem)
+	for _, id := range ids {
+		blog, ok := m.blogs[id]
+		if !ok || blog.deleted() {
+			continue
+		}
+
+		blog.DeleteTime = deleteTime
+		blog.Revision++
+		m.blogs[id] = blog
+		m.index.remove(id)
+		m.events.publish(EventDeleted, blog)
+
+		deleted[id] = blog
+	}
+
+	return deleted, nil
+}
+
+func (m *memoryStore) Undelete(_ context.Context, id primitive.ObjectID) (BlogItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.blogs[id]
+	if !ok {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	if !stored.deleted() {
+		return BlogItem{}, errBlogNotDeleted
+	}
+
+	stored.DeleteTime = time.Time{}
+	stored.Revision++
+	m.blogs[id] = stored
+	m.index.add(stored)
+	m.events.publish(EventCreated, stored)
+
+	return stored, nil
+}
+
+func (m *memoryStore) ListPurgeable(_ context.Context, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []primitive.ObjectID
+
+	for id, blog := range m.blogs {
+		if blog.deleted() && blog.DeleteTime.Before(deletedBefore) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *memoryStore) Purge(_ context.Context, ids []primitive.ObjectID, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged []primitive.ObjectID
+
+	for _, id := range ids {
+		blog, ok := m.blogs[id]
+		if ok && blog.deleted() && blog.DeleteTime.Before(deletedBefore) {
+			delete(m.blogs, id)
+			delete(m.slugs, blog.Slug)
+			delete(m.revisions, id)
+			purged = append(purged, id)
+		}
+	}
+
+	return purged, nil
+}
+
+func (m *memoryStore) List(ctx context.Context, query ListQuery, fn func(BlogItem) error) error {
+	blogs := m.snapshot()
+	sort.SliceStable(blogs, func(i, j int) bool {
+		return query.Order.less(blogs[i], blogs[j])
+	})
+
+	var count int64
+
+	for _, blog := range blogs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !matchesQuery(blog, query) {
+			continue
+		}
+
+		if query.Limit > 0 && count == query.Limit {
+			break
+		}
+		count++
+
+		err := fn(blog)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStore) Search(_ context.Context, query string, viewer primitive.ObjectID, limit int64) ([]SearchHit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids, scores := m.index.search(queryTerms(query))
+
+	var hits []SearchHit
+	for _, id := range ids {
+		if limit > 0 && int64(len(hits)) == limit {
+			break
+		}
+
+		blog := m.blogs[id]
+		if blog.deleted() || !blog.visibleTo(viewer) {
+			continue
+		}
+
+		hits = append(hits, SearchHit{
+			Blog:  blog,
+			Score: scores[id],
+		})
+	}
+
+	return hits, nil
+}
+
+func (m *memoryStore) ListScheduled(_ context.Context, until time.Time) ([]BlogItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var blogs []BlogItem
+	for _, blog := range m.blogs {
+		if !blog.deleted() && blog.state() == StateScheduled && !blog.PublishTime.After(until) {
+			blogs = append(blogs, blog)
+		}
+	}
+
+	return blogs, nil
+}
+
+func (m *memoryStore) ListTags(_ context.Context, viewer primitive.ObjectID, limit int64) ([]TagCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, blog := range m.blogs {
+		if blog.deleted() || !blog.visibleTo(viewer) {
+			continue
+		}
+
+		for _, tag := range blog.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+
+	return sortTagCounts(tags, limit), nil
+}
+
+func (m *memoryStore) Watch(ctx context.Context, resumeToken string, viewer primitive.ObjectID, fn func(BlogEvent) error) error {
+	return m.events.watch(ctx, resumeToken, func(event BlogEvent) error {
+		if !event.Blog.visibleTo(viewer) {
+			return nil
+		}
+
+		return fn(event)
+	})
+}
+
+func (m *memoryStore) AddRevision(_ context.Context, revision BlogRevisionItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history := append(m.revisions[revision.BlogID], revision)
+	// revisions of concurrent changes may be recorded out of order
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+	m.revisions[revision.BlogID] = history
+
+	return nil
+}
+
+func (m *memoryStore) GetRevision(_ context.Context, blogID primitive.ObjectID, revision int64) (BlogRevisionItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rev := range m.revisions[blogID] {
+		if rev.Revision == revision {
+			return rev, nil
+		}
+	}
+
+	return BlogRevisionItem{}, errRevisionNotFound
+}
+
+func (m *memoryStore) ListRevisions(_ context.Context, blogID primitive.ObjectID, before int64, limit int64) ([]BlogRevisionItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := m.revisions[blogID]
+
+	var revs []BlogRevisionItem
+	for i := len(history) - 1; i >= 0; i-- {
+		if before > 0 && history[i].Revision >= before {
+			continue
+		}
+
+		if limit > 0 && int64(len(revs)) == limit {
+			break
+		}
+
+		revs = append(revs, history[i])
+	}
+
+	return revs, nil
+}
+
+// snapshot returns a copy of all blogs ordered by id, so callers can iterate
+// without holding the lock.
+func (m *memoryStore) snapshot() []BlogItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	blogs := make([]BlogItem, 0, len(m.blogs))
+	for _, blog := range m.blogs {
+		blogs = append(blogs, blog)
+	}
+
+	sort.Slice(blogs, func(i, j int) bool {
+		return bytes.Compare(blogs[i].ID[:], blogs[j].ID[:]) < 0
+	})
+
+	return blogs
+}
+
+// matchesTags reports whether tags contain any, or all if all is set, of
+// wanted.
+func matchesTags(tags, wanted []string, all bool) bool {
+	for _, tag := range wanted {
+		found := containsString(tags, tag)
+		if found && !all {
+			return true
+		}
+		if !found && all {
+			return false
+		}
+	}
+
+	return all
+}
+
+// matchesQuery is the in-memory equivalent of listFilter.
+func matchesQuery(blog BlogItem, query ListQuery) bool {
+	if !query.AuthorID.IsZero() && blog.AuthorID != query.AuthorID {
+		return false
+	}
+
+	if query.Deleted == HideDeleted && blog.deleted() {
+		return false
+	}
+
+	if query.Deleted == OnlyDeleted && !blog.deleted() {
+		return false
+	}
+
+	if !strings.HasPrefix(blog.Title, query.TitlePrefix) {
+		return false
+	}
+
+	if query.PublishedOnly && !blog.visibleTo(query.Viewer) {
+		return false
+	}
+
+	if len(query.Tags) > 0 && !matchesTags(blog.Tags, query.Tags, query.MatchAllTags) {
+		return false
+	}
+
+	if !query.CreatedAfter.IsZero() && !blog.CreateTime.After(query.CreatedAfter) {
+		return false
+	}
+
+	if !query.CreatedBefore.IsZero() && !blog.CreateTime.Before(query.CreatedBefore) {
+		return false
+	}
+
+	if query.After != nil && !query.Order.after(blog, query.After) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// seededStore returns a memory store holding a live blog and a deleted one.
+func seededStore(t *testing.T) (*memoryStore, BlogItem, BlogItem) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := newMemoryStore()
+
+	live, err := m.Create(ctx, BlogItem{
+		ID:         primitive.NewObjectID(),
+		AuthorID:   primitive.NewObjectID(),
+		Title:      "Live",
+		Slug:       "live",
+		CreateTime: now,
+		UpdateTime: now,
+		Revision:   1,
+		State:      StatePublished,
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	gone, err := m.Create(ctx, BlogItem{
+		ID:         primitive.NewObjectID(),
+		AuthorID:   live.AuthorID,
+		Title:      "Gone",
+		Slug:       "gone",
+		CreateTime: now,
+		UpdateTime: now,
+		Revision:   1,
+		State:      StatePublished,
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	gone, err = m.Delete(ctx, gone.ID, nil, now)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	return m, live, gone
+}
+
+func revision(r int64) *int64 {
+	return &r
+}
+
+func TestMemoryStoreCreate(t *testing.T) {
+	m, live, gone := seededStore(t)
+
+	tests := []struct {
+		name    string
+		blog    BlogItem
+		wantErr error
+	}{
+		{"new", BlogItem{ID: primitive.NewObjectID(), Title: "New", Slug: "new", Revision: 1}, nil},
+		{"without slug", BlogItem{ID: primitive.NewObjectID(), Title: "Old", Revision: 1}, nil},
+		{"existing id", BlogItem{ID: live.ID, Title: "Again", Slug: "again", Revision: 1}, errBlogExists},
+		{"deleted id", BlogItem{ID: gone.ID, Title: "Again", Slug: "again", Revision: 1}, errBlogExists},
+		{"slug of a live blog", BlogItem{ID: primitive.NewObjectID(), Title: "Live", Slug: live.Slug, Revision: 1}, errSlugTaken},
+		{"slug of a deleted blog", BlogItem{ID: primitive.NewObjectID(), Title: "Gone", Slug: gone.Slug, Revision: 1}, errSlugTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := m.Create(context.Background(), tt.blog)
+			if err != tt.wantErr {
+				t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := m.Get(context.Background(), tt.blog.ID)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, created) {
+				t.Errorf("Get() = %+v, want %+v", got, created)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreGet(t *testing.T) {
+	m, live, gone := seededStore(t)
+
+	tests := []struct {
+		name    string
+		get     func(ctx context.Context) (BlogItem, error)
+		want    BlogItem
+		wantErr error
+	}{
+		{"live", func(ctx context.Context) (BlogItem, error) { return m.Get(ctx, live.ID) }, live, nil},
+		{"deleted", func(ctx context.Context) (BlogItem, error) { return m.Get(ctx, gone.ID) }, gone, nil},
+		{"missing", func(ctx context.Context) (BlogItem, error) { return m.Get(ctx, primitive.NewObjectID()) }, BlogItem{}, errBlogNotFound},
+		{"live by slug", func(ctx context.Context) (BlogItem, error) { return m.GetBySlug(ctx, live.Slug) }, live, nil},
+		{"deleted by slug", func(ctx context.Context) (BlogItem, error) { return m.GetBySlug(ctx, gone.Slug) }, gone, nil},
+		{"missing slug", func(ctx context.Context) (BlogItem, error) { return m.GetBySlug(ctx, "missing") }, BlogItem{}, errBlogNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get(context.Background())
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	missing := primitive.NewObjectID()
+	now := time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		id          func(live, gone BlogItem) primitive.ObjectID
+		update      BlogUpdate
+		wantErr     error
+		wantTitle   string
+		wantCreated bool
+	}{
+		{
+			name:      "title",
+			update:    BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}},
+			wantTitle: "Changed",
+		},
+		{
+			name:      "at the revision",
+			update:    BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}, Revision: revision(1)},
+			wantTitle: "Changed",
+		},
+		{
+			name:    "at another revision",
+			update:  BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}, Revision: revision(2)},
+			wantErr: errBlogRevisionMismatch,
+		},
+		{
+			name:    "slug of another blog",
+			update:  BlogUpdate{Blog: BlogItem{Slug: "gone"}, Fields: []string{"slug"}},
+			wantErr: errSlugTaken,
+		},
+		{
+			name:    "missing",
+			id:      func(live, gone BlogItem) primitive.ObjectID { return missing },
+			update:  BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}},
+			wantErr: errBlogNotFound,
+		},
+		{
+			name:        "missing allowed",
+			id:          func(live, gone BlogItem) primitive.ObjectID { return missing },
+			update:      BlogUpdate{Blog: BlogItem{Title: "Created", UpdateTime: now}, Fields: []string{"title", "update_time"}, AllowMissing: true},
+			wantTitle:   "Created",
+			wantCreated: true,
+		},
+		{
+			name:    "missing allowed at a revision",
+			id:      func(live, gone BlogItem) primitive.ObjectID { return missing },
+			update:  BlogUpdate{Blog: BlogItem{Title: "Created"}, Fields: []string{"title"}, Revision: revision(1), AllowMissing: true},
+			wantErr: errBlogNotFound,
+		},
+		{
+			name:    "deleted",
+			id:      func(live, gone BlogItem) primitive.ObjectID { return gone.ID },
+			update:  BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}},
+			wantErr: errBlogNotFound,
+		},
+		{
+			name:    "deleted with missing allowed",
+			id:      func(live, gone BlogItem) primitive.ObjectID { return gone.ID },
+			update:  BlogUpdate{Blog: BlogItem{Title: "Changed"}, Fields: []string{"title"}, AllowMissing: true},
+			wantErr: errBlogExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, live, gone := seededStore(t)
+
+			id := live.ID
+			if tt.id != nil {
+				id = tt.id(live, gone)
+			}
+
+			before, _ := m.Get(ctx, id)
+
+			res, err := m.Update(ctx, id, tt.update)
+			if err != tt.wantErr {
+				t.Fatalf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+
+			got, _ := m.Get(ctx, id)
+
+			if err != nil {
+				if !reflect.DeepEqual(got, before) {
+					t.Errorf("failed Update() changed the blog to %+v", got)
+				}
+				return
+			}
+
+			if res.Created != tt.wantCreated {
+				t.Errorf("Update() created = %v, want %v", res.Created, tt.wantCreated)
+			}
+			if !reflect.DeepEqual(res.Before, before) {
+				t.Errorf("Update() before = %+v, want %+v", res.Before, before)
+			}
+			if !reflect.DeepEqual(got, res.Blog) {
+				t.Errorf("Get() = %+v, want the updated %+v", got, res.Blog)
+			}
+			if got.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", got.Title, tt.wantTitle)
+			}
+			if got.Revision != before.Revision+1 {
+				t.Errorf("revision = %v, want %v", got.Revision, before.Revision+1)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	now := time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		deleted  bool
+		missing  bool
+		revision *int64
+		wantErr  error
+	}{
+		{name: "live"},
+		{name: "at the revision", revision: revision(1)},
+		{name: "at another revision", revision: revision(2), wantErr: errBlogRevisionMismatch},
+		{name: "deleted", deleted: true, wantErr: errBlogNotFound},
+		{name: "missing", missing: true, wantErr: errBlogNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, live, gone := seededStore(t)
+
+			id := live.ID
+			switch {
+			case tt.deleted:
+				id = gone.ID
+			case tt.missing:
+				id = primitive.NewObjectID()
+			}
+
+			deleted, err := m.Delete(ctx, id, tt.revision, now)
+			if err != tt.wantErr {
+				t.Fatalf("Delete() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !deleted.DeleteTime.Equal(now) || deleted.Revision != live.Revision+1 {
+				t.Errorf("Delete() = %+v, want it deleted at %v and revision %v", deleted, now, live.Revision+1)
+			}
+
+			// deleted blogs are kept until they are purged
+			got, err := m.Get(ctx, id)
+			if err != nil || !reflect.DeepEqual(got, deleted) {
+				t.Errorf("Get() = %+v, %v, want %+v", got, err, deleted)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreUndelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      func(live, gone BlogItem) primitive.ObjectID
+		wantErr error
+	}{
+		{"deleted", func(live, gone BlogItem) primitive.ObjectID { return gone.ID }, nil},
+		{"live", func(live, gone BlogItem) primitive.ObjectID { return live.ID }, errBlogNotDeleted},
+		{"missing", func(live, gone BlogItem) primitive.ObjectID { return primitive.NewObjectID() }, errBlogNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, live, gone := seededStore(t)
+
+			restored, err := m.Undelete(context.Background(), tt.id(live, gone))
+			if err != tt.wantErr {
+				t.Fatalf("Undelete() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if restored.deleted() || restored.Revision != gone.Revision+1 {
+				t.Errorf("Undelete() = %+v, want it restored at revision %v", restored, gone.Revision+1)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreList(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := newMemoryStore()
+
+	author := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	blogs := make(map[string]BlogItem)
+	for i, blog := range []BlogItem{
+		{Title: "Alpha", AuthorID: author, State: StatePublished, Tags: []string{"go", "grpc"}},
+		{Title: "Beta", AuthorID: author, State: StateDraft, Tags: []string{"go"}},
+		{Title: "Gamma", AuthorID: other, State: StatePublished, Tags: []string{"grpc"}},
+		{Title: "Delta", AuthorID: other, State: StateDraft},
+		{Title: "Epsilon", AuthorID: other, State: StatePublished, DeleteTime: now},
+	} {
+		blog.ID = primitive.NewObjectID()
+		blog.Revision = 1
+		blog.CreateTime = now.Add(time.Duration(i) * time.Hour)
+
+		_, err := m.Create(ctx, blog)
+		if err != nil {
+			t.Fatalf("Create(%v) failed: %v", blog.Title, err)
+		}
+
+		blogs[blog.Title] = blog
+	}
+
+	cursor := func(title string) *Cursor {
+		return &Cursor{Key: title, ID: blogs[title].ID}
+	}
+
+	tests := []struct {
+		name  string
+		query ListQuery
+		want  []string
+	}{
+		{"by title", ListQuery{Order: Ordering{Field: "title"}}, []string{"Alpha", "Beta", "Delta", "Gamma"}},
+		{"by title descending", ListQuery{Order: Ordering{Field: "title", Descending: true}}, []string{"Gamma", "Delta", "Beta", "Alpha"}},
+		{"limit", ListQuery{Order: Ordering{Field: "title"}, Limit: 2}, []string{"Alpha", "Beta"}},
+		{"after", ListQuery{Order: Ordering{Field: "title"}, After: cursor("Beta")}, []string{"Delta", "Gamma"}},
+		{"show deleted", ListQuery{Order: Ordering{Field: "title"}, Deleted: ShowDeleted}, []string{"Alpha", "Beta", "Delta", "Epsilon", "Gamma"}},
+		{"only deleted", ListQuery{Order: Ordering{Field: "title"}, Deleted: OnlyDeleted}, []string{"Epsilon"}},
+		{"author", ListQuery{Order: Ordering{Field: "title"}, AuthorID: author}, []string{"Alpha", "Beta"}},
+		{"title prefix", ListQuery{Order: Ordering{Field: "title"}, TitlePrefix: "Al"}, []string{"Alpha"}},
+		{"any tag", ListQuery{Order: Ordering{Field: "title"}, Tags: []string{"go", "grpc"}}, []string{"Alpha", "Beta", "Gamma"}},
+		{"all tags", ListQuery{Order: Ordering{Field: "title"}, Tags: []string{"go", "grpc"}, MatchAllTags: true}, []string{"Alpha"}},
+		{"created after", ListQuery{Order: Ordering{Field: "title"}, CreatedAfter: blogs["Beta"].CreateTime}, []string{"Delta", "Gamma"}},
+		{"published", ListQuery{Order: Ordering{Field: "title"}, PublishedOnly: true}, []string{"Alpha", "Gamma"}},
+		{"published or by the viewer", ListQuery{Order: Ordering{Field: "title"}, PublishedOnly: true, Viewer: other}, []string{"Alpha", "Delta", "Gamma"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			err := m.List(ctx, tt.query, func(blog BlogItem) error {
+				got = append(got, blog.Title)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
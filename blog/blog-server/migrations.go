@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsCollection records the migrations applied to a database.
+const migrationsCollection = "schema_migrations"
+
+// migration is a change to the schema of a tenant database, applied once per
+// database in the order of migrations. Servers starting at the same time may
+// both apply it, so it has to be safe to apply again.
+type migration struct {
+	// id is recorded once the migration is applied, it must never change.
+	id          string
+	description string
+	// apply applies the migration to db and returns the number of documents
+	// it changed. With dryRun set it changes nothing and returns the number
+	// of documents it would change.
+	apply func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error)
+}
+
+// migrations are the migrations of the blog server. New ones go at the end.
+var migrations = []migration{
+	{
+		id:          "0001_initial_indexes",
+		description: "create the indexes of the stores",
+		apply: func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+			if dryRun {
+				return 0, nil
+			}
+
+			// the indexes servers created on startup before there were
+			// migrations. EnsureIndexes must not change anymore, indexes
+			// added later get migrations of their own.
+			for _, indexed := range []interface {
+				EnsureIndexes(ctx context.Context) error
+			}{newMongoStore(db), newMongoCommentStore(db), newMongoAuthorStore(db), newMongoAttachmentStore(db)} {
+				err := indexed.EnsureIndexes(ctx)
+				if err != nil {
+					return 0, err
+				}
+			}
+
+			return 0, nil
+		},
+	},
+	{
+		id:          "0002_blog_author_index",
+		description: "index blogs by author for listing the blogs of an author",
+		apply: func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+			if dryRun {
+				return 0, nil
+			}
+
+			_, err := db.Collection("blog").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: primitive.D{
+					{Key: "authorId", Value: 1},
+					{Key: "_id", Value: 1},
+				},
+				Options: options.Index().SetName("blog_author"),
+			})
+
+			return 0, err
+		},
+	},
+	{
+		id:          "0003_backfill_blog_state",
+		description: "set the state of blogs stored before blogs had states to published",
+		apply:       backfill("blog", "state", StatePublished),
+	},
+	{
+		id:          "0004_backfill_blog_content_format",
+		description: "set the content format of blogs stored before blogs had formats to plain",
+		apply:       backfill("blog", "contentFormat", ContentPlain),
+	},
+	{
+		id:          "0005_backfill_blog_slugs",
+		description: "give blogs stored before blogs had slugs a slug derived from their title",
+		apply:       backfillSlugs,
+	},
+	{
+		id:          "0006_blog_text_language",
+		description: "rebuild the blog text index without a language, so it matches words like the in-memory index",
+		apply:       rebuildBlogTextIndex,
+	},
+}
+
+// backfill returns a migration setting field to value in the documents of
+// collection that do not have it. The value has to be what the server
+// assumed for those documents, so nothing but the documents changes.
+func backfill(collection, field string, value interface{}) func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+	return func(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+		filter := primitive.M{field: primitive.M{"$exists": false}}
+
+		if dryRun {
+			return db.Collection(collection).CountDocuments(ctx, filter)
+		}
+
+		result, err := db.Collection(collection).UpdateMany(ctx, filter, primitive.M{
+			"$set": primitive.M{field: value},
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		return result.ModifiedCount, nil
+	}
+}
+
+// backfillSlugs gives the blogs without a slug the first free slug candidate
+// of their title, like createBlog does for new ones.
+func backfillSlugs(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+	blogs := db.Collection("blog")
+	filter := primitive.M{"slug": primitive.M{"$exists": false}}
+
+	if dryRun {
+		return blogs.CountDocuments(ctx, filter)
+	}
+
+	cursor, err := blogs.Find(ctx, filter, options.Find().SetProjection(primitive.M{"title": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var changed int64
+
+	for cursor.Next(ctx) {
+		var blog BlogItem
+
+		err = cursor.Decode(&blog)
+		if err != nil {
+			return changed, err
+		}
+
+		base := slugify(blog.Title)
+
+		for attempt := 0; ; attempt++ {
+			// a server applying the migration at the same time may have
+			// given the blog a slug already
+			result, err := blogs.UpdateOne(ctx, primitive.M{
+				"_id":  blog.ID,
+				"slug": primitive.M{"$exists": false},
+			}, primitive.M{
+				"$set": primitive.M{"slug": slugCandidate(base, blog.ID, attempt)},
+			})
+			if isSlugTaken(err) && attempt < slugAttempts {
+				continue
+			}
+			if err != nil {
+				return changed, err
+			}
+
+			changed += result.ModifiedCount
+			break
+		}
+	}
+
+	return changed, cursor.Err()
+}
+
+// rebuildBlogTextIndex replaces a blog text index created with a language by
+// one without, see blogTextIndex.
+func rebuildBlogTextIndex(ctx context.Context, db *mongo.Database, dryRun bool) (int64, error) {
+	if dryRun {
+		return 0, nil
+	}
+
+	indexes := db.Collection("blog").Indexes()
+
+	cursor, err := indexes.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var specs []struct {
+		Name            string `bson:"name"`
+		DefaultLanguage string `bson:"default_language"`
+	}
+
+	err = cursor.All(ctx, &specs)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, spec := range specs {
+		if spec.Name != "blog_text" || spec.DefaultLanguage == "none" {
+			continue
+		}
+
+		// there is no text search until the index is created again
+		_, err = indexes.DropOne(ctx, spec.Name)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{
+			{Key: "title", Value: "text"},
+			{Key: "content", Value: "text"},
+		},
+		Options: blogTextIndex(),
+	})
+
+	return 0, err
+}
+
+// appliedMigration is the record of an applied migration.
+type appliedMigration struct {
+	ID          string    `bson:"_id"`
+	Description string    `bson:"description"`
+	ApplyTime   time.Time `bson:"applyTime"`
+	// Changed is the number of documents the migration changed.
+	Changed int64 `bson:"changed"`
+}
+
+// pendingMigrations returns the migrations not yet applied to db. It fails if
+// db has migrations applied this server does not know, which means it was
+// migrated by a newer one.
+func pendingMigrations(ctx context.Context, db *mongo.Database) ([]migration, error) {
+	cursor, err := db.Collection(migrationsCollection).Find(ctx, primitive.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []appliedMigration
+
+	err = cursor.All(ctx, &applied)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool)
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	var pending []migration
+
+	for _, m := range migrations {
+		if done[m.id] {
+			delete(done, m.id)
+			continue
+		}
+
+		pending = append(pending, m)
+	}
+
+	if len(done) > 0 {
+		unknown := make([]string, 0, len(done))
+		for id := range done {
+			unknown = append(unknown, id)
+		}
+		sort.Strings(unknown)
+
+		return nil, fmt.Errorf("database %v has unknown migrations %v applied, it was migrated by a newer server", db.Name(), strings.Join(unknown, ", "))
+	}
+
+	return pending, nil
+}
+
+// migrate applies the pending migrations to db. With dryRun set it only logs
+// what they would change.
+func migrate(ctx context.Context, db *mongo.Database, dryRun bool) error {
+	pending, err := pendingMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		changed, err := m.apply(ctx, db, dryRun)
+		if err != nil {
+			return fmt.Errorf("migration %v of database %v failed: %v", m.id, db.Name(), err)
+		}
+
+		if dryRun {
+			log.Printf("Would apply migration %v to database %v, changing %v documents: %v", m.id, db.Name(), changed, m.description)
+			continue
+		}
+
+		_, err = db.Collection(migrationsCollection).InsertOne(ctx, appliedMigration{
+			ID:          m.id,
+			Description: m.description,
+			ApplyTime:   timeNow(),
+			Changed:     changed,
+		})
+		// applied by another server at the same time
+		if mongo.IsDuplicateKeyError(err) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Applied migration %v to database %v, changing %v documents: %v", m.id, db.Name(), changed, m.description)
+	}
+
+	return nil
+}
+
+// migrateTenants migrates the databases of tenants in order and registers
+// them, see migrate and registerMongoTenant.
+func migrateTenants(ctx context.Context, client *mongo.Client, database string, tenants []string, dryRun bool) error {
+	for _, tenant := range tenants {
+		err := migrate(ctx, client.Database(tenantDatabase(database, tenant)), dryRun)
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			continue
+		}
+
+		err = registerMongoTenant(ctx, client, database, tenant)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runMigrate is the migrate command, which migrates the databases of the
+// tenants the server serves, the default tenant, the registered ones and the
+// ones of the tenants setting, and exits.
+func runMigrate(args []string) {
+	cfg, err := loadConfig("migrate", args)
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
+
+	if cfg.Store != "mongo" {
+		log.Fatalf("migrations only apply to the mongo store, not %v", cfg.Store)
+	}
+
+	client, existing := connectMongo(cfg)
+	defer client.Disconnect(context.Background())
+
+	tenants := append([]string{defaultTenant}, existing...)
+
+	seen := make(map[string]bool)
+	for _, tenant := range tenants {
+		seen[tenant] = true
+	}
+
+	for _, tenant := range cfg.Tenants {
+		if !seen[tenant] {
+			seen[tenant] = true
+			tenants = append(tenants, tenant)
+		}
+	}
+
+	err = migrateTenants(context.Background(), client, cfg.Database, tenants, cfg.DryRun)
+	if err != nil {
+		log.Fatalln("Error while migrating the databases", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attachmentBucket is the name of the GridFS bucket attachments are kept in.
+const attachmentBucket = "attachments"
+
+// mongoAttachmentStore keeps attachments in GridFS, with the id of their blog
+// in the metadata of the file.
+type mongoAttachmentStore struct {
+	db *mongo.Database
+}
+
+func newMongoAttachmentStore(db *mongo.Database) *mongoAttachmentStore {
+	return &mongoAttachmentStore{db: db}
+}
+
+// EnsureIndexes creates the indexes of the store if they are missing.
+func (m *mongoAttachmentStore) EnsureIndexes(ctx context.Context) error {
+	_, err := m.db.Collection(attachmentBucket+".files").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    primitive.D{{Key: "metadata.blogId", Value: 1}},
+		Options: options.Index().SetName("attachment_blog"),
+	})
+
+	return err
+}
+
+// bucket returns the GridFS bucket for a single call. GridFS does not take
+// contexts, the deadline of ctx is applied to the bucket instead.
+func (m *mongoAttachmentStore) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(m.db, options.GridFSBucket().SetName(attachmentBucket))
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = bucket.SetReadDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		err = bucket.SetWriteDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bucket, nil
+}
+
+func (m *mongoAttachmentStore) Put(ctx context.Context, blogID, id primitive.ObjectID, filename string, r io.Reader) (int64, error) {
+	bucket, err := m.bucket(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingReader{r: r}
+
+	err = bucket.UploadFromStreamWithID(id, filename, counter, options.GridFSUpload().SetMetadata(primitive.M{
+		"blogId": blogID,
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.n, nil
+}
+
+func (m *mongoAttachmentStore) Open(ctx context.Context, blogID, id primitive.ObjectID) (io.ReadCloser, error) {
+	bucket, err := m.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := bucket.OpenDownloadStream(id)
+	if err == gridfs.ErrFileNotFound {
+		return nil, errAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func (m *mongoAttachmentStore) Delete(ctx context.Context, blogID, id primitive.ObjectID) error {
+	bucket, err := m.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = bucket.Delete(id)
+	if err == gridfs.ErrFileNotFound {
+		return errAttachmentNotFound
+	}
+
+	return err
+}
+
+func (m *mongoAttachmentStore) DeleteBlogAttachments(ctx context.Context, blogIDs []primitive.ObjectID) error {
+	bucket, err := m.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := bucket.Find(primitive.M{
+		"metadata.blogId": primitive.M{"$in": blogIDs},
+	})
+	if err != nil {
+		return err
+	}
+
+	var files []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	err = cursor.All(ctx, &files)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err = bucket.Delete(file.ID)
+		if err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAuthorStore struct {
+	collection *mongo.Collection
+}
+
+func newMongoAuthorStore(db *mongo.Database) *mongoAuthorStore {
+	return &mongoAuthorStore{collection: db.Collection("authors")}
+}
+
+// EnsureIndexes creates the indexes of the store if they are missing.
+func (m *mongoAuthorStore) EnsureIndexes(ctx context.Context) error {
+	// authors without an email leave the field out, so they are not part of
+	// the index and do not collide with each other
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "email", Value: 1}},
+		Options: options.Index().
+			SetName("author_email").
+			SetUnique(true).
+			SetPartialFilterExpression(primitive.M{"email": primitive.M{"$exists": true}}),
+	})
+
+	return err
+}
+
+func (m *mongoAuthorStore) CreateAuthor(ctx context.Context, author AuthorItem) (AuthorItem, error) {
+	_, err := m.collection.InsertOne(ctx, author)
+	if mongo.IsDuplicateKeyError(err) {
+		return AuthorItem{}, errAuthorEmailTaken
+	}
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return author, nil
+}
+
+func (m *mongoAuthorStore) GetAuthor(ctx context.Context, id primitive.ObjectID) (AuthorItem, error) {
+	result := m.collection.FindOne(ctx, primitive.M{"_id": id})
+	if result.Err() == mongo.ErrNoDocuments {
+		return AuthorItem{}, errAuthorNotFound
+	}
+
+	var author AuthorItem
+
+	err := result.Decode(&author)
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return author, nil
+}
+
+func (m *mongoAuthorStore) ListAuthors(ctx context.Context, after primitive.ObjectID, limit int64) ([]AuthorItem, error) {
+	filter := primitive.M{}
+	if !after.IsZero() {
+		filter["_id"] = primitive.M{"$gt": after}
+	}
+
+	opt := options.Find().SetSort(primitive.D{{Key: "_id", Value: 1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	authorCursor, err := m.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var authors []AuthorItem
+
+	err = authorCursor.All(ctx, &authors)
+	if err != nil {
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+func (m *mongoAuthorStore) UpdateAuthor(ctx context.Context, id primitive.ObjectID, author AuthorItem, fields []string) (AuthorItem, error) {
+	set := primitive.M{}
+	unset := primitive.M{}
+
+	for _, field := range fields {
+		f := authorFields[field]
+
+		// an empty email is removed to keep the author out of the unique
+		// email index
+		if value := f.get(author); value == "" {
+			unset[f.key] = ""
+		} else {
+			set[f.key] = value
+		}
+	}
+
+	update := primitive.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	after := options.After
+	opt := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	result := m.collection.FindOneAndUpdate(ctx, primitive.M{"_id": id}, update, opt)
+	if result.Err() == mongo.ErrNoDocuments {
+		return AuthorItem{}, errAuthorNotFound
+	}
+	if mongo.IsDuplicateKeyError(result.Err()) {
+		return AuthorItem{}, errAuthorEmailTaken
+	}
+	if result.Err() != nil {
+		return AuthorItem{}, result.Err()
+	}
+
+	var updated AuthorItem
+
+	err := result.Decode(&updated)
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCommentStore struct {
+	collection *mongo.Collection
+}
+
+func newMongoCommentStore(db *mongo.Database) *mongoCommentStore {
+	return &mongoCommentStore{collection: db.Collection("comments")}
+}
+
+// EnsureIndexes creates the indexes of the store if they are missing.
+func (m *mongoCommentStore) EnsureIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{
+			{Key: "blogId", Value: 1},
+			{Key: "parentId", Value: 1},
+			{Key: "_id", Value: 1},
+		},
+		Options: options.Index().SetName("comment_thread"),
+	})
+
+	return err
+}
+
+func (m *mongoCommentStore) CreateComment(ctx context.Context, comment CommentItem) (CommentItem, error) {
+	_, err := m.collection.InsertOne(ctx, comment)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return comment, nil
+}
+
+func (m *mongoCommentStore) GetComment(ctx context.Context, blogID, id primitive.ObjectID) (CommentItem, error) {
+	result := m.collection.FindOne(ctx, primitive.M{
+		"_id":    id,
+		"blogId": blogID,
+	})
+	if result.Err() == mongo.ErrNoDocuments {
+		return CommentItem{}, errCommentNotFound
+	}
+
+	var comment CommentItem
+
+	err := result.Decode(&comment)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return comment, nil
+}
+
+func (m *mongoCommentStore) ListComments(ctx context.Context, blogID, parentID, after primitive.ObjectID, limit int64) ([]CommentItem, error) {
+	filter := primitive.M{
+		"blogId":   blogID,
+		"parentId": primitive.M{"$exists": false},
+	}
+	if !parentID.IsZero() {
+		filter["parentId"] = parentID
+	}
+	if !after.IsZero() {
+		filter["_id"] = primitive.M{"$gt": after}
+	}
+
+	opt := options.Find().SetSort(primitive.D{{Key: "_id", Value: 1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	commentCursor, err := m.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []CommentItem
+
+	err = commentCursor.All(ctx, &comments)
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (m *mongoCommentStore) UpdateComment(ctx context.Context, blogID, id primitive.ObjectID, content string, updateTime time.Time) (CommentItem, error) {
+	after := options.After
+	opt := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	result := m.collection.FindOneAndUpdate(ctx, primitive.M{
+		"_id":    id,
+		"blogId": blogID,
+	}, primitive.M{
+		"$set": primitive.M{
+			"content":    content,
+			"updateTime": updateTime,
+		},
+	}, opt)
+	if result.Err() == mongo.ErrNoDocuments {
+		return CommentItem{}, errCommentNotFound
+	}
+	if result.Err() != nil {
+		return CommentItem{}, result.Err()
+	}
+
+	var comment CommentItem
+
+	err := result.Decode(&comment)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return comment, nil
+}
+
+func (m *mongoCommentStore) DeleteComment(ctx context.Context, blogID, id primitive.ObjectID) (int64, error) {
+	_, err := m.GetComment(ctx, blogID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	// collect the whole reply tree level by level before removing it
+	ids := []interface{}{id}
+	level := []interface{}{id}
+	for len(level) > 0 {
+		replies, err := m.collection.Distinct(ctx, "_id", primitive.M{
+			"blogId":   blogID,
+			"parentId": primitive.M{"$in": level},
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		ids = append(ids, replies...)
+		level = replies
+	}
+
+	result, err := m.collection.DeleteMany(ctx, primitive.M{
+		"_id": primitive.M{"$in": ids},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (m *mongoCommentStore) DeleteBlogComments(ctx context.Context, blogIDs []primitive.ObjectID) error {
+	_, err := m.collection.DeleteMany(ctx, primitive.M{
+		"blogId": primitive.M{"$in": blogIDs},
+	})
+
+	return err
+}
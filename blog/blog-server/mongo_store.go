@@ -0,0 +1,895 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	collection *mongo.Collection
+	revisions  *mongo.Collection
+}
+
+func newMongoStore(db *mongo.Database) *mongoStore {
+	return &mongoStore{
+		collection: db.Collection("blog"),
+		revisions:  db.Collection("blog_revisions"),
+	}
+}
+
+// EnsureIndexes creates the indexes of the store if they are missing.
+func (m *mongoStore) EnsureIndexes(ctx context.Context) error {
+	// created with the default english language before there were
+	// migrations, 0006_blog_text_language rebuilds it as blogTextIndex
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{
+			{Key: "title", Value: "text"},
+			{Key: "content", Value: "text"},
+		},
+		Options: options.Index().
+			SetName("blog_text").
+			SetWeights(primitive.M{"title": titleWeight, "content": 1}),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    primitive.D{{Key: "tags", Value: 1}},
+		Options: options.Index().SetName("blog_tags"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// blogs stored before blogs had slugs have none
+	_, err = m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "slug", Value: 1}},
+		Options: options.Index().
+			SetName(slugIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(primitive.M{"slug": primitive.M{"$exists": true}}),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{
+			{Key: "state", Value: 1},
+			{Key: "publishTime", Value: 1},
+		},
+		Options: options.Index().SetName("blog_schedule"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.revisions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{
+			{Key: "blogId", Value: 1},
+			{Key: "revision", Value: -1},
+		},
+		Options: options.Index().SetName("blog_revision").SetUnique(true),
+	})
+
+	return err
+}
+
+// blogTextIndex are the options of the text index. Without a language mongo
+// neither stems words nor drops stop words, matching the in-memory index.
+func blogTextIndex() *options.IndexOptions {
+	return options.Index().
+		SetName("blog_text").
+		SetWeights(primitive.M{"title": titleWeight, "content": 1}).
+		SetDefaultLanguage("none")
+}
+
+// textSearch turns a search query into the words tokenize finds in it, so the
+// negations and phrases of the $text query syntax are not applied.
+func textSearch(query string) string {
+	terms := make([]string, 0)
+	for term := range queryTerms(query) {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	return strings.Join(terms, " ")
+}
+
+func (m *mongoStore) Create(ctx context.Context, blog BlogItem) (BlogItem, error) {
+	_, err := m.collection.InsertOne(ctx, blog)
+	if isSlugTaken(err) {
+		return BlogItem{}, errSlugTaken
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return BlogItem{}, errBlogExists
+	}
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return blog, nil
+}
+
+func (m *mongoStore) CreateMany(ctx context.Context, blogs []BlogItem, atomic bool) ([]error, error) {
+	errs := make([]error, len(blogs))
+	if len(blogs) == 0 {
+		return errs, nil
+	}
+
+	docs := make([]interface{}, len(blogs))
+	for i, blog := range blogs {
+		docs[i] = blog
+	}
+
+	_, err := m.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return errs, err
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if isSlugTaken(writeErr) {
+			errs[writeErr.Index] = errSlugTaken
+		} else if mongo.IsDuplicateKeyError(writeErr) {
+			errs[writeErr.Index] = errBlogExists
+		} else {
+			errs[writeErr.Index] = writeErr
+		}
+	}
+
+	if atomic {
+		// there are no transactions outside of replica sets, undo the inserts
+		// that went through instead
+		var inserted []primitive.ObjectID
+		for i, blog := range blogs {
+			if errs[i] == nil {
+				inserted = append(inserted, blog.ID)
+			}
+		}
+
+		_, err = m.collection.DeleteMany(ctx, primitive.M{
+			"_id": primitive.M{"$in": inserted},
+		})
+		if err != nil {
+			return errs, err
+		}
+
+		return errs, errBatchAborted
+	}
+
+	return errs, nil
+}
+
+func (m *mongoStore) Get(ctx context.Context, id primitive.ObjectID) (BlogItem, error) {
+	result := m.collection.FindOne(ctx, primitive.M{
+		"_id": id,
+	})
+	if result.Err() == mongo.ErrNoDocuments {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	var blog BlogItem
+
+	err := result.Decode(&blog)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return blog, nil
+}
+
+func (m *mongoStore) GetBySlug(ctx context.Context, slug string) (BlogItem, error) {
+	result := m.collection.FindOne(ctx, primitive.M{
+		"slug": slug,
+	})
+	if result.Err() == mongo.ErrNoDocuments {
+		return BlogItem{}, errBlogNotFound
+	}
+
+	var blog BlogItem
+
+	err := result.Decode(&blog)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return blog, nil
+}
+
+func (m *mongoStore) GetMany(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]BlogItem, error) {
+	return m.findMany(ctx, primitive.M{
+		"_id": primitive.M{"$in": ids},
+	})
+}
+
+func (m *mongoStore) findMany(ctx context.Context, filter primitive.M) (map[primitive.ObjectID]BlogItem, error) {
+	blogCursor, err := m.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []BlogItem
+
+	err = blogCursor.All(ctx, &found)
+	if err != nil {
+		return nil, err
+	}
+
+	blogs := make(map[primitive.ObjectID]BlogItem, len(found))
+	for _, blog := range found {
+		blogs[blog.ID] = blog
+	}
+
+	return blogs, nil
+}
+
+func (m *mongoStore) Update(ctx context.Context, id primitive.ObjectID, update BlogUpdate) (UpdateResult, error) {
+	set := primitive.M{}
+	unset := primitive.M{}
+	for _, field := range update.Fields {
+		value := blogFields[field].get(update.Blog)
+
+		// cleared times are removed like omitempty leaves them out on insert
+		if t, ok := value.(time.Time); ok && t.IsZero() {
+			unset[blogFields[field].key] = ""
+			continue
+		}
+
+		set[blogFields[field].key] = value
+	}
+
+	// a blog with a revision to match exists already, upserting would only
+	// collide with it on the _id
+	upsert := update.AllowMissing && update.Revision == nil
+
+	// the document from before the update tells whether one got inserted and
+	// lets us work out the result without reading it back
+	before := options.Before
+	opt := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &before,
+		Upsert:         &upsert,
+	}
+
+	setOnInsert := primitive.M{"createTime": update.Blog.UpdateTime}
+	if upsert {
+		setOnInsert["state"] = StateDraft
+	}
+
+	change := primitive.M{
+		"$set":         set,
+		"$inc":         primitive.M{"revision": 1},
+		"$setOnInsert": setOnInsert,
+	}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+
+	result := m.collection.FindOneAndUpdate(ctx, revisionFilter(id, update.Revision), change, opt)
+	if isSlugTaken(result.Err()) {
+		return UpdateResult{}, errSlugTaken
+	}
+	if mongo.IsDuplicateKeyError(result.Err()) {
+		// the upsert hit a deleted blog with the same id
+		return UpdateResult{}, errBlogExists
+	}
+	if result.Err() == mongo.ErrNoDocuments && !upsert {
+		return UpdateResult{}, m.missingError(ctx, id)
+	}
+	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
+		return UpdateResult{}, result.Err()
+	}
+
+	res := UpdateResult{
+		Created: result.Err() == mongo.ErrNoDocuments,
+	}
+
+	if !res.Created {
+		err := result.Decode(&res.Before)
+		if err != nil {
+			return UpdateResult{}, err
+		}
+	}
+
+	res.Blog = applyUpdate(id, res.Before, res.Created, update)
+
+	return res, nil
+}
+
+func (m *mongoStore) Delete(ctx context.Context, id primitive.ObjectID, revision *int64, deleteTime time.Time) (BlogItem, error) {
+	after := options.After
+	opt := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	result := m.collection.FindOneAndUpdate(ctx, revisionFilter(id, revision), primitive.M{
+		"$set": primitive.M{"deleteTime": deleteTime},
+		"$inc": primitive.M{"revision": 1},
+	}, opt)
+	if result.Err() == mongo.ErrNoDocuments {
+		return BlogItem{}, m.missingError(ctx, id)
+	}
+	if result.Err() != nil {
+		return BlogItem{}, result.Err()
+	}
+
+	var blog BlogItem
+
+	err := result.Decode(&blog)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return blog, nil
+}
+
+func (m *mongoStore) DeleteMany(ctx context.Context, ids []primitive.ObjectID, deleteTime time.Time, atomic bool) (map[primitive.ObjectID]BlogItem, error) {
+	filter := primitive.M{
+		"_id":        primitive.M{"$in": ids},
+		"deleteTime": primitive.M{"$exists": false},
+	}
+
+	unique := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	if atomic {
+		count, err := m.collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if count != int64(len(unique)) {
+			return nil, errBlogNotFound
+		}
+	}
+
+	result, err := m.collection.UpdateMany(ctx, filter, primitive.M{
+		"$set": primitive.M{"deleteTime": deleteTime},
+		"$inc": primitive.M{"revision": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deletedFilter := primitive.M{
+		"_id":        primitive.M{"$in": ids},
+		"deleteTime": deleteTime,
+	}
+
+	if atomic && result.ModifiedCount != int64(len(unique)) {
+		// some blog got deleted concurrently since counting, restore the ones
+		// deleted here
+		_, err = m.collection.UpdateMany(ctx, deletedFilter, primitive.M{
+			"$unset": primitive.M{"deleteTime": ""},
+			"$inc":   primitive.M{"revision": 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errBlogNotFound
+	}
+
+	return m.findMany(ctx, deletedFilter)
+}
+
+func (m *mongoStore) Undelete(ctx context.Context, id primitive.ObjectID) (BlogItem, error) {
+	after := options.After
+	opt := &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	result := m.collection.FindOneAndUpdate(ctx, primitive.M{
+		"_id":        id,
+		"deleteTime": primitive.M{"$exists": true},
+	}, primitive.M{
+		"$unset": primitive.M{"deleteTime": ""},
+		"$inc":   primitive.M{"revision": 1},
+	}, opt)
+	if result.Err() == mongo.ErrNoDocuments {
+		_, err := m.Get(ctx, id)
+		if err != nil {
+			return BlogItem{}, err
+		}
+
+		return BlogItem{}, errBlogNotDeleted
+	}
+	if result.Err() != nil {
+		return BlogItem{}, result.Err()
+	}
+
+	var blog BlogItem
+
+	err := result.Decode(&blog)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return blog, nil
+}
+
+func (m *mongoStore) ListPurgeable(ctx context.Context, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	ids, err := m.collection.Distinct(ctx, "_id", primitive.M{
+		"deleteTime": primitive.M{"$lt": deletedBefore},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeable := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			purgeable = append(purgeable, oid)
+		}
+	}
+
+	return purgeable, nil
+}
+
+func (m *mongoStore) Purge(ctx context.Context, ids []primitive.ObjectID, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	filter := primitive.M{
+		"_id":        primitive.M{"$in": ids},
+		"deleteTime": primitive.M{"$lt": deletedBefore},
+	}
+
+	// blogs undeleted in the meantime are left alone
+	purged, err := m.collection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(purged) == 0 {
+		return nil, nil
+	}
+
+	_, err = m.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.revisions.DeleteMany(ctx, primitive.M{
+		"blogId": primitive.M{"$in": purged},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]primitive.ObjectID, 0, len(purged))
+	for _, id := range purged {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			removed = append(removed, oid)
+		}
+	}
+
+	return removed, nil
+}
+
+// missingError tells apart why a filter built by revisionFilter matched no
+// document: either the blog does not exist, is deleted or is at another
+// revision.
+func (m *mongoStore) missingError(ctx context.Context, id primitive.ObjectID) error {
+	blog, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if blog.deleted() {
+		return errBlogNotFound
+	}
+
+	return errBlogRevisionMismatch
+}
+
+// revisionFilter matches the blog with the given id unless it is deleted, and
+// only at the given revision when it is not nil. Blogs stored before
+// revisions existed have no revision field and count as revision 0.
+func revisionFilter(id primitive.ObjectID, revision *int64) primitive.M {
+	filter := primitive.M{
+		"_id":        id,
+		"deleteTime": primitive.M{"$exists": false},
+	}
+
+	if revision != nil {
+		if *revision == 0 {
+			filter["revision"] = primitive.M{"$in": primitive.A{0, nil}}
+		} else {
+			filter["revision"] = *revision
+		}
+	}
+
+	return filter
+}
+
+// isSlugTaken tells whether err is a violation of the unique slug index.
+func isSlugTaken(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), slugIndex)
+}
+
+func (m *mongoStore) List(ctx context.Context, query ListQuery, fn func(BlogItem) error) error {
+	filter := listFilter(query)
+
+	direction := 1
+	if query.Order.Descending {
+		direction = -1
+	}
+
+	sortKey := query.Order.field().key
+	sort := primitive.D{{Key: sortKey, Value: direction}}
+	if sortKey != "_id" {
+		sort = append(sort, primitive.E{Key: "_id", Value: direction})
+	}
+
+	opt := options.Find().SetSort(sort)
+	if query.Limit > 0 {
+		opt.SetLimit(query.Limit)
+	}
+
+	blogCursor, err := m.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return err
+	}
+	defer blogCursor.Close(ctx)
+
+	for blogCursor.Next(ctx) {
+		var blog BlogItem
+
+		err = blogCursor.Decode(&blog)
+		if err != nil {
+			return err
+		}
+
+		err = fn(blog)
+		if err != nil {
+			return err
+		}
+	}
+
+	return blogCursor.Err()
+}
+
+func (m *mongoStore) Search(ctx context.Context, query string, viewer primitive.ObjectID, limit int64) ([]SearchHit, error) {
+	score := primitive.M{"$meta": "textScore"}
+
+	opt := options.Find().
+		SetProjection(primitive.M{"score": score}).
+		SetSort(primitive.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	blogCursor, err := m.collection.Find(ctx, primitive.M{
+		"$text":      primitive.M{"$search": textSearch(query), "$language": "none"},
+		"deleteTime": primitive.M{"$exists": false},
+		"$and":       primitive.A{visibleFilter("", viewer)},
+	}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer blogCursor.Close(ctx)
+
+	var hits []SearchHit
+
+	for blogCursor.Next(ctx) {
+		var hit struct {
+			BlogItem `bson:",inline"`
+			Score    float64 `bson:"score"`
+		}
+
+		err = blogCursor.Decode(&hit)
+		if err != nil {
+			return nil, err
+		}
+
+		hits = append(hits, SearchHit{
+			Blog:  hit.BlogItem,
+			Score: hit.Score,
+		})
+	}
+
+	return hits, blogCursor.Err()
+}
+
+func (m *mongoStore) ListScheduled(ctx context.Context, until time.Time) ([]BlogItem, error) {
+	blogCursor, err := m.collection.Find(ctx, primitive.M{
+		"state":       StateScheduled,
+		"publishTime": primitive.M{"$lte": until},
+		"deleteTime":  primitive.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var blogs []BlogItem
+
+	err = blogCursor.All(ctx, &blogs)
+	if err != nil {
+		return nil, err
+	}
+
+	return blogs, nil
+}
+
+func (m *mongoStore) ListTags(ctx context.Context, viewer primitive.ObjectID, limit int64) ([]TagCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: primitive.M{
+			"deleteTime": primitive.M{"$exists": false},
+			"tags":       primitive.M{"$exists": true},
+			"$and":       primitive.A{visibleFilter("", viewer)},
+		}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: primitive.M{
+			"_id":   "$tags",
+			"count": primitive.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: primitive.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, primitive.D{{Key: "$limit", Value: limit}})
+	}
+
+	tagCursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []TagCount
+
+	err = tagCursor.All(ctx, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Watch is backed by a change stream, which requires mongodb to run as a
+// replica set.
+func (m *mongoStore) Watch(ctx context.Context, resumeToken string, viewer primitive.ObjectID, fn func(BlogEvent) error) error {
+	opt := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	if resumeToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(resumeToken)
+		if err != nil || bson.Raw(raw).Validate() != nil {
+			return errInvalidResumeToken
+		}
+
+		opt.SetResumeAfter(bson.Raw(raw))
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: primitive.M{
+			"operationType": primitive.M{"$in": primitive.A{"insert", "update", "replace"}},
+			"$and":          primitive.A{visibleFilter("fullDocument.", viewer)},
+		}}},
+	}
+
+	stream, err := m.collection.Watch(ctx, pipeline, opt)
+	if err != nil {
+		if isHistoryLost(err) {
+			return errResumeTokenExpired
+		}
+
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change struct {
+			OperationType     string    `bson:"operationType"`
+			FullDocument      *BlogItem `bson:"fullDocument"`
+			UpdateDescription struct {
+				UpdatedFields primitive.M `bson:"updatedFields"`
+				RemovedFields []string    `bson:"removedFields"`
+			} `bson:"updateDescription"`
+		}
+
+		err = stream.Decode(&change)
+		if err != nil {
+			return err
+		}
+
+		// the document may be gone by the time the update is looked up
+		if change.FullDocument == nil {
+			continue
+		}
+
+		event := BlogEvent{
+			Type:        EventUpdated,
+			Blog:        *change.FullDocument,
+			ResumeToken: base64.RawURLEncoding.EncodeToString(stream.ResumeToken()),
+		}
+
+		_, deleted := change.UpdateDescription.UpdatedFields["deleteTime"]
+
+		switch {
+		case change.OperationType == "insert":
+			event.Type = EventCreated
+		case deleted:
+			event.Type = EventDeleted
+		case containsString(change.UpdateDescription.RemovedFields, "deleteTime"):
+			event.Type = EventCreated
+		}
+
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isHistoryLost(stream.Err()) {
+		return errResumeTokenExpired
+	}
+
+	return stream.Err()
+}
+
+// isHistoryLost reports whether a change stream could not be resumed because
+// the oplog no longer reaches back to the resume token.
+func isHistoryLost(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorCode(286)
+	}
+
+	return false
+}
+
+func (m *mongoStore) AddRevision(ctx context.Context, revision BlogRevisionItem) error {
+	_, err := m.revisions.InsertOne(ctx, revision)
+
+	return err
+}
+
+func (m *mongoStore) GetRevision(ctx context.Context, blogID primitive.ObjectID, revision int64) (BlogRevisionItem, error) {
+	result := m.revisions.FindOne(ctx, primitive.M{
+		"blogId":   blogID,
+		"revision": revision,
+	})
+	if result.Err() == mongo.ErrNoDocuments {
+		return BlogRevisionItem{}, errRevisionNotFound
+	}
+
+	var rev BlogRevisionItem
+
+	err := result.Decode(&rev)
+	if err != nil {
+		return BlogRevisionItem{}, err
+	}
+
+	return rev, nil
+}
+
+func (m *mongoStore) ListRevisions(ctx context.Context, blogID primitive.ObjectID, before int64, limit int64) ([]BlogRevisionItem, error) {
+	filter := primitive.M{"blogId": blogID}
+	if before > 0 {
+		filter["revision"] = primitive.M{"$lt": before}
+	}
+
+	opt := options.Find().SetSort(primitive.D{{Key: "revision", Value: -1}})
+	if limit > 0 {
+		opt.SetLimit(limit)
+	}
+
+	revCursor, err := m.revisions.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []BlogRevisionItem
+
+	err = revCursor.All(ctx, &revs)
+	if err != nil {
+		return nil, err
+	}
+
+	return revs, nil
+}
+
+// visibleFilter is the mongo equivalent of BlogItem.visibleTo for blogs
+// stored under prefix, which is empty for the blog collection itself.
+func visibleFilter(prefix string, viewer primitive.ObjectID) primitive.M {
+	visible := primitive.A{
+		primitive.M{prefix + "state": StatePublished},
+		primitive.M{prefix + "state": primitive.M{"$exists": false}},
+	}
+	if !viewer.IsZero() {
+		visible = append(visible, primitive.M{prefix + "authorId": viewer})
+	}
+
+	return primitive.M{"$or": visible}
+}
+
+// listFilter translates the filters and cursor of query into a mongo filter.
+func listFilter(query ListQuery) primitive.M {
+	filter := primitive.M{}
+
+	if !query.AuthorID.IsZero() {
+		filter["authorId"] = query.AuthorID
+	}
+
+	switch query.Deleted {
+	case HideDeleted:
+		filter["deleteTime"] = primitive.M{"$exists": false}
+	case OnlyDeleted:
+		filter["deleteTime"] = primitive.M{"$exists": true}
+	}
+
+	if query.TitlePrefix != "" {
+		filter["title"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.TitlePrefix)}
+	}
+
+	if len(query.Tags) > 0 {
+		op := "$in"
+		if query.MatchAllTags {
+			op = "$all"
+		}
+
+		filter["tags"] = primitive.M{op: query.Tags}
+	}
+
+	if query.PublishedOnly {
+		// $or is taken by the cursor already
+		filter["$and"] = primitive.A{visibleFilter("", query.Viewer)}
+	}
+
+	createTime := primitive.M{}
+	if !query.CreatedAfter.IsZero() {
+		createTime["$gt"] = query.CreatedAfter
+	}
+	if !query.CreatedBefore.IsZero() {
+		createTime["$lt"] = query.CreatedBefore
+	}
+	if len(createTime) > 0 {
+		filter["createTime"] = createTime
+	}
+
+	if query.After != nil {
+		op := "$gt"
+		if query.Order.Descending {
+			op = "$lt"
+		}
+
+		field := query.Order.field()
+		sortKey := field.key
+		if sortKey == "_id" {
+			filter["_id"] = primitive.M{op: query.After.ID}
+		} else {
+			after := primitive.A{
+				primitive.M{sortKey: primitive.M{op: query.After.Key}},
+				primitive.M{sortKey: query.After.Key, "_id": primitive.M{op: query.After.ID}},
+			}
+
+			// blogs stored without the field, like the delete time of blogs
+			// that are not deleted, sort before every value like the zero
+			// value does in memory, but comparisons never match them
+			missing := primitive.M{"$exists": false}
+			if compareValues(query.After.Key, field.value(BlogItem{})) == 0 {
+				after = append(after, primitive.M{sortKey: missing, "_id": primitive.M{op: query.After.ID}})
+			} else if query.Order.Descending {
+				after = append(after, primitive.M{sortKey: missing})
+			}
+
+			filter["$or"] = after
+		}
+	}
+
+	return filter
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sortFields maps the field names accepted in order_by to the document key
+// they sort on and a getter for the in-memory store and page cursors. Getters
+// return bson native values so cursors round trip through bson unchanged.
+var sortFields = map[string]sortField{
+	"id": {
+		key:   "_id",
+		value: func(b BlogItem) interface{} { return b.ID },
+	},
+	"title": {
+		key:   "title",
+		value: func(b BlogItem) interface{} { return b.Title },
+	},
+	"create_time": {
+		key:   "createTime",
+		value: func(b BlogItem) interface{} { return primitive.NewDateTimeFromTime(b.CreateTime) },
+	},
+	"update_time": {
+		key:   "updateTime",
+		value: func(b BlogItem) interface{} { return primitive.NewDateTimeFromTime(b.UpdateTime) },
+	},
+	"delete_time": {
+		key:   "deleteTime",
+		value: func(b BlogItem) interface{} { return primitive.NewDateTimeFromTime(b.DeleteTime) },
+	},
+}
+
+type sortField struct {
+	key   string
+	value func(BlogItem) interface{}
+}
+
+// Ordering is the sort order of a list query, the zero value sorts by id
+// ascending. Ties are always broken by id in the same direction.
+type Ordering struct {
+	Field      string
+	Descending bool
+}
+
+func (o Ordering) field() sortField {
+	if o.Field == "" {
+		return sortFields["id"]
+	}
+
+	return sortFields[o.Field]
+}
+
+func (o Ordering) String() string {
+	field := o.Field
+	if field == "" {
+		field = "id"
+	}
+
+	if o.Descending {
+		return field + " desc"
+	}
+
+	return field + " asc"
+}
+
+// parseOrderBy parses an order_by value of the form "<field> [asc|desc]".
+func parseOrderBy(orderBy string) (Ordering, error) {
+	parts := strings.Fields(strings.ToLower(orderBy))
+	if len(parts) == 0 {
+		return Ordering{}, nil
+	}
+
+	if len(parts) > 2 {
+		return Ordering{}, invalidField("order_by", "invalid order_by: %q, expected \"<field> [asc|desc]\"", orderBy)
+	}
+
+	if _, ok := sortFields[parts[0]]; !ok {
+		return Ordering{}, invalidField("order_by", "unknown sort key in order_by: %q", parts[0])
+	}
+
+	ordering := Ordering{Field: parts[0]}
+
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "asc":
+		case "desc":
+			ordering.Descending = true
+		default:
+			return Ordering{}, invalidField("order_by", "invalid sort direction in order_by: %q", parts[1])
+		}
+	}
+
+	return ordering, nil
+}
+
+// less reports whether a sorts before b.
+func (o Ordering) less(a, b BlogItem) bool {
+	field := o.field()
+
+	c := compareValues(field.value(a), field.value(b))
+	if c == 0 {
+		c = compareValues(a.ID, b.ID)
+	}
+
+	if o.Descending {
+		return c > 0
+	}
+
+	return c < 0
+}
+
+// after reports whether blog sorts after the cursor.
+func (o Ordering) after(blog BlogItem, cursor *Cursor) bool {
+	c := compareValues(o.field().value(blog), cursor.Key)
+	if c == 0 {
+		c = compareValues(blog.ID, cursor.ID)
+	}
+
+	if o.Descending {
+		return c < 0
+	}
+
+	return c > 0
+}
+
+// compareValues compares two values returned by a sortField getter.
+func compareValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case primitive.ObjectID:
+		bv, _ := b.(primitive.ObjectID)
+		return bytes.Compare(av[:], bv[:])
+	case string:
+		bv, _ := b.(string)
+		return strings.Compare(av, bv)
+	case primitive.DateTime:
+		bv, _ := b.(primitive.DateTime)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// nextPageTrailer is the trailer key ListBlog uses to hand out the token for
+// the next page.
+const nextPageTrailer = "next-page-token"
+
+// pageToken is the decoded form of a page token. It remembers the ordering it
+// was issued for so it can not be replayed against a different one.
+type pageToken struct {
+	OrderBy string `bson:"o"`
+	Cursor  Cursor `bson:"c"`
+}
+
+// Page tokens are the url safe base64 encoding of a bson encoded pageToken,
+// so they survive being put into query strings untouched.
+func encodePageToken(order Ordering, cursor Cursor) (string, error) {
+	raw, err := bson.Marshal(pageToken{
+		OrderBy: order.String(),
+		Cursor:  cursor,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodePageToken(token string, order Ordering) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalidField("page_token", "invalid page token: %v", token)
+	}
+
+	var decoded pageToken
+
+	err = bson.Unmarshal(raw, &decoded)
+	if err != nil {
+		return nil, invalidField("page_token", "invalid page token: %v", token)
+	}
+
+	if decoded.OrderBy != order.String() {
+		return nil, invalidField("page_token", "page token was issued for order_by %q, not %q", decoded.OrderBy, order)
+	}
+
+	return &decoded.Cursor, nil
+}
+
+// Lists ordered by id only, like comments and authors, use the url safe
+// base64 encoding of the id of the last item of a page as token for the next
+// one.
+func encodeIDPageToken(after primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(after[:])
+}
+
+func decodeIDPageToken(token string) (primitive.ObjectID, error) {
+	var after primitive.ObjectID
+
+	if token == "" {
+		return after, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != len(after) {
+		return after, invalidField("page_token", "invalid page token: %v", token)
+	}
+
+	copy(after[:], raw)
+
+	return after, nil
+}
+
+// listQuery translates the filters, ordering and page token of req into a
+// ListQuery.
+func listQuery(req *blogpb.ListBlogRequest) (ListQuery, error) {
+	order, err := parseOrderBy(req.GetOrderBy())
+	if err != nil {
+		return ListQuery{}, err
+	}
+
+	after, err := decodePageToken(req.GetPageToken(), order)
+	if err != nil {
+		return ListQuery{}, err
+	}
+
+	tags, err := normalizeTags("tags", req.GetTags())
+	if err != nil {
+		return ListQuery{}, err
+	}
+
+	query := ListQuery{
+		TitlePrefix:  req.GetTitlePrefix(),
+		Tags:         tags,
+		MatchAllTags: req.GetMatchAllTags(),
+		Order:        order,
+		After:        after,
+	}
+
+	if req.GetOnlyDeleted() {
+		query.Deleted = OnlyDeleted
+	} else if req.GetShowDeleted() {
+		query.Deleted = ShowDeleted
+	}
+
+	if req.GetCreatedAfter() != nil {
+		query.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+
+	if req.GetCreatedBefore() != nil {
+		query.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	if req.GetAuthorId() != "" {
+		query.AuthorID, err = primitive.ObjectIDFromHex(req.GetAuthorId())
+		if err != nil {
+			return ListQuery{}, invalidField("author_id", "the provided author id: %v is not a objectid string", req.GetAuthorId())
+		}
+	}
+
+	return query, nil
+}
+
+// listPage calls fn for at most page_size blogs matching req and returns the
+// token of the following page, which is empty once the end of the list is
+// reached. defaultSize is used when the request leaves the page size unset,
+// zero meaning every blog.
+func (s *server) listPage(ctx context.Context, req *blogpb.ListBlogRequest, defaultSize int32, fn func(BlogItem) error) (string, error) {
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return "", invalidField("page_size", "page size must not be negative: %v", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	query, err := listQuery(req)
+	if err != nil {
+		return "", err
+	}
+
+	query.PublishedOnly = true
+	query.Viewer = viewerID(ctx)
+
+	if pageSize > 0 {
+		// fetch one extra blog to find out whether there is a next page
+		query.Limit = int64(pageSize) + 1
+	}
+
+	var count int32
+	var last BlogItem
+	hasMore := false
+
+	err = s.store.List(ctx, query, func(blog BlogItem) error {
+		if pageSize > 0 && count == pageSize {
+			hasMore = true
+			return nil
+		}
+		count++
+		last = blog
+
+		return fn(blog)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !hasMore {
+		return "", nil
+	}
+
+	return encodePageToken(query.Order, Cursor{
+		Key: query.Order.field().value(last),
+		ID:  last.ID,
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+)
+
+var blogStateToBlogpb = map[BlogState]blogpb.Blog_State{
+	StateDraft:     blogpb.Blog_DRAFT,
+	StateScheduled: blogpb.Blog_SCHEDULED,
+	StatePublished: blogpb.Blog_PUBLISHED,
+	StateArchived:  blogpb.Blog_ARCHIVED,
+}
+
+var blogStateFromBlogpb = map[blogpb.Blog_State]BlogState{
+	blogpb.Blog_DRAFT:     StateDraft,
+	blogpb.Blog_SCHEDULED: StateScheduled,
+	blogpb.Blog_PUBLISHED: StatePublished,
+	blogpb.Blog_ARCHIVED:  StateArchived,
+}
+
+// Clock tells the publish scheduler what time it is, so tests can move time
+// forward by hand.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return timeNow()
+}
+
+func (s *server) PublishBlog(ctx context.Context, req *blogpb.PublishBlogRequest) (*blogpb.PublishBlogResponse, error) {
+	log.Println("Publish Blog Request RPC Call")
+
+	id := req.GetBlogId()
+
+	now := timeNow()
+	data := BlogItem{
+		State:       StatePublished,
+		PublishTime: now,
+		UpdateTime:  now,
+	}
+
+	if req.GetPublishTime() != nil {
+		publishTime := req.GetPublishTime().AsTime().Truncate(time.Millisecond)
+		if publishTime.After(now) {
+			data.State = StateScheduled
+			data.PublishTime = publishTime
+		}
+	}
+
+	blog, err := s.changeState(ctx, id, req.GetEtag(), data, []string{"state", "publish_time"}, func(state BlogState) bool {
+		return state != StatePublished
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &blogpb.PublishBlogResponse{
+		Blog: blogItemToBlogpb(blog),
+	}
+
+	return res, nil
+}
+
+func (s *server) UnpublishBlog(ctx context.Context, req *blogpb.UnpublishBlogRequest) (*blogpb.UnpublishBlogResponse, error) {
+	log.Println("Unpublish Blog Request RPC Call")
+
+	id := req.GetBlogId()
+
+	// drafts lose their publish time, archived blogs keep it to tell when
+	// they went out
+	data := BlogItem{
+		State:      StateDraft,
+		UpdateTime: timeNow(),
+	}
+	fields := []string{"state", "publish_time"}
+
+	if req.GetArchive() {
+		data.State = StateArchived
+		fields = fields[:1]
+	}
+
+	blog, err := s.changeState(ctx, id, req.GetEtag(), data, fields, func(state BlogState) bool {
+		return state == StatePublished || state == StateScheduled
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &blogpb.UnpublishBlogResponse{
+		Blog: blogItemToBlogpb(blog),
+	}
+
+	return res, nil
+}
+
+// changeState copies the given fields of data, which include the state, to
+// the blog with the given id if allowed accepts its current state, and records
+// the change.
+func (s *server) changeState(ctx context.Context, id string, etag string, data BlogItem, fields []string, allowed func(BlogState) bool) (BlogItem, error) {
+	blogId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return BlogItem{}, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	revision, err := parseEtag("etag", etag)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	blog, err := s.store.Get(ctx, blogId)
+	if err == nil && blog.deleted() {
+		err = errBlogNotFound
+	}
+	if err == nil && revision != nil && *revision != blog.Revision {
+		err = errBlogRevisionMismatch
+	}
+	if err != nil {
+		return BlogItem{}, storeError(err, "blog", id)
+	}
+
+	if !allowed(blog.state()) {
+		return BlogItem{}, errorWithInfo(codes.FailedPrecondition, "INVALID_STATE", "blog", id, "Blog with the id: %v is %v and can not be moved to %v", id, blog.state(), data.State)
+	}
+
+	// the state was checked at the revision just read, so the update must
+	// not apply to any later one
+	result, err := s.store.Update(ctx, blogId, BlogUpdate{
+		Blog:     data,
+		Fields:   append(fields, "update_time"),
+		Revision: &blog.Revision,
+	})
+	if err != nil {
+		return BlogItem{}, storeError(err, "blog", id)
+	}
+
+	action := RevisionPublish
+	if data.State == StateDraft || data.State == StateArchived {
+		action = RevisionUnpublish
+	}
+	s.recordRevision(ctx, action, result.Before, result.Blog, 0)
+
+	return result.Blog, nil
+}
+
+// runScheduler publishes scheduled blogs once their publish time has come,
+// checking every interval until ctx is done.
+func (s *server) runScheduler(ctx context.Context, clock Clock, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := clock.Now()
+
+		s.forEachTenant(ctx, func(ctx context.Context) {
+			s.publishDue(ctx, now)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDue publishes the scheduled blogs whose publish time is not after
+// now.
+func (s *server) publishDue(ctx context.Context, now time.Time) {
+	blogs, err := s.store.ListScheduled(ctx, now)
+	if err != nil {
+		log.Printf("Error while looking for scheduled blogs of tenant %v: %v", tenantFromContext(ctx), err)
+		return
+	}
+
+	published := 0
+
+	for _, blog := range blogs {
+		// the publish time is kept as scheduled
+		result, err := s.store.Update(ctx, blog.ID, BlogUpdate{
+			Blog:     BlogItem{State: StatePublished, UpdateTime: now},
+			Fields:   []string{"state", "update_time"},
+			Revision: &blog.Revision,
+		})
+		if err == errBlogNotFound || err == errBlogRevisionMismatch {
+			// changed since it was listed, the next run picks it up again
+			// if it is still due
+			continue
+		}
+		if err != nil {
+			log.Printf("Error while publishing scheduled blog %v: %v", blog.ID.Hex(), err)
+			continue
+		}
+
+		s.recordRevision(ctx, RevisionPublish, result.Before, result.Blog, 0)
+		published++
+	}
+
+	if published > 0 {
+		log.Printf("Published %v scheduled blogs of tenant %v", published, tenantFromContext(ctx))
+	}
+}
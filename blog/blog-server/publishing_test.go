@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// racingStore changes a blog between listing the scheduled blogs and
+// publishing them, like a call of a user would.
+type racingStore struct {
+	BlogStore
+	race func(ctx context.Context, blogs []BlogItem)
+}
+
+func (s racingStore) ListScheduled(ctx context.Context, until time.Time) ([]BlogItem, error) {
+	blogs, err := s.BlogStore.ListScheduled(ctx, until)
+	if err == nil {
+		s.race(ctx, blogs)
+	}
+
+	return blogs, err
+}
+
+func scheduledBlog(t *testing.T, store BlogStore, title string, publishTime time.Time) BlogItem {
+	t.Helper()
+
+	blog, err := store.Create(context.Background(), BlogItem{
+		ID:          primitive.NewObjectID(),
+		AuthorID:    primitive.NewObjectID(),
+		Title:       title,
+		Slug:        slugify(title),
+		CreateTime:  publishTime.Add(-time.Hour),
+		UpdateTime:  publishTime.Add(-time.Hour),
+		Revision:    1,
+		State:       StateScheduled,
+		PublishTime: publishTime,
+	})
+	if err != nil {
+		t.Fatalf("Create(%q) failed: %v", title, err)
+	}
+
+	return blog
+}
+
+func TestPublishDue(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		publishTime time.Time
+		advance     time.Duration
+		want        BlogState
+	}{
+		{"not due yet", start.Add(time.Hour), 59 * time.Minute, StateScheduled},
+		{"due now", start.Add(time.Hour), time.Hour, StatePublished},
+		{"overdue", start.Add(time.Hour), 2 * time.Hour, StatePublished},
+		{"due before the clock started", start.Add(-time.Minute), 0, StatePublished},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &fakeClock{now: start}
+			s := &server{store: newMemoryStore()}
+
+			blog := scheduledBlog(t, s.store, "Scheduled", tt.publishTime)
+
+			clock.advance(tt.advance)
+			s.publishDue(ctx, clock.Now())
+
+			got, err := s.store.Get(ctx, blog.ID)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+
+			if got.State != tt.want {
+				t.Errorf("state = %v, want %v", got.State, tt.want)
+			}
+			if !got.PublishTime.Equal(tt.publishTime) {
+				t.Errorf("publish time = %v, want the scheduled %v", got.PublishTime, tt.publishTime)
+			}
+
+			if tt.want != StatePublished {
+				return
+			}
+
+			if got.Revision != blog.Revision+1 {
+				t.Errorf("revision = %v, want %v", got.Revision, blog.Revision+1)
+			}
+			if !got.UpdateTime.Equal(clock.Now()) {
+				t.Errorf("update time = %v, want %v", got.UpdateTime, clock.Now())
+			}
+
+			revision, err := s.store.GetRevision(ctx, blog.ID, got.Revision)
+			if err != nil {
+				t.Fatalf("GetRevision failed: %v", err)
+			}
+			if revision.Action != RevisionPublish {
+				t.Errorf("revision action = %v, want %v", revision.Action, RevisionPublish)
+			}
+		})
+	}
+}
+
+func TestPublishDueLostRace(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+	memory := newMemoryStore()
+
+	won := scheduledBlog(t, memory, "Won", clock.Now())
+	lost := scheduledBlog(t, memory, "Lost", clock.Now())
+
+	// the author moves the publish time of one blog out while it is being
+	// published
+	later := clock.Now().Add(time.Hour)
+	s := &server{store: racingStore{
+		BlogStore: memory,
+		race: func(ctx context.Context, blogs []BlogItem) {
+			_, err := memory.Update(ctx, lost.ID, BlogUpdate{
+				Blog:   BlogItem{PublishTime: later, UpdateTime: clock.Now()},
+				Fields: []string{"publish_time", "update_time"},
+			})
+			if err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+		},
+	}}
+
+	s.publishDue(ctx, clock.Now())
+
+	tests := []struct {
+		name     string
+		id       primitive.ObjectID
+		state    BlogState
+		revision int64
+	}{
+		{"won", won.ID, StatePublished, 2},
+		{"lost", lost.ID, StateScheduled, 2},
+	}
+
+	for _, tt := range tests {
+		got, err := memory.Get(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("%v: Get failed: %v", tt.name, err)
+		}
+
+		if got.State != tt.state {
+			t.Errorf("%v: state = %v, want %v", tt.name, got.State, tt.state)
+		}
+		if got.Revision != tt.revision {
+			t.Errorf("%v: revision = %v, want %v", tt.name, got.Revision, tt.revision)
+		}
+	}
+
+	// the next run leaves the blog alone until its new publish time
+	s = &server{store: memory}
+
+	clock.advance(59 * time.Minute)
+	s.publishDue(ctx, clock.Now())
+
+	got, _ := memory.Get(ctx, lost.ID)
+	if got.State != StateScheduled {
+		t.Errorf("state before the new publish time = %v, want %v", got.State, StateScheduled)
+	}
+
+	clock.advance(time.Minute)
+	s.publishDue(ctx, clock.Now())
+
+	got, _ = memory.Get(ctx, lost.ID)
+	if got.State != StatePublished {
+		t.Errorf("state at the new publish time = %v, want %v", got.State, StatePublished)
+	}
+}
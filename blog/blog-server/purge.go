@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPurger permanently removes blogs that have been deleted for longer than
+// retention together with their comments and attachments, checking every
+// interval until ctx is done.
+func (s *server) runPurger(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deletedBefore := timeNow().Add(-retention)
+
+		s.forEachTenant(ctx, func(ctx context.Context) {
+			s.purge(ctx, deletedBefore)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) purge(ctx context.Context, deletedBefore time.Time) {
+	ids, err := s.store.ListPurgeable(ctx, deletedBefore)
+	if err != nil {
+		log.Printf("Error while purging deleted blogs of tenant %v: %v", tenantFromContext(ctx), err)
+		return
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	// the blogs go last, so a failure leaves them to be retried by the next
+	// run instead of orphaning their comments or attachments. A blog undeleted
+	// in between is kept, without its comments and attachments.
+	err = s.comments.DeleteBlogComments(ctx, ids)
+	if err != nil {
+		log.Printf("Error while purging comments of deleted blogs of tenant %v: %v", tenantFromContext(ctx), err)
+		return
+	}
+
+	err = s.attachments.DeleteBlogAttachments(ctx, ids)
+	if err != nil {
+		log.Printf("Error while purging attachments of deleted blogs of tenant %v: %v", tenantFromContext(ctx), err)
+		return
+	}
+
+	purged, err := s.store.Purge(ctx, ids, deletedBefore)
+	if err != nil {
+		log.Printf("Error while purging deleted blogs of tenant %v: %v", tenantFromContext(ctx), err)
+		return
+	}
+
+	if len(purged) > 0 {
+		log.Printf("Purged %v deleted blogs of tenant %v", len(purged), tenantFromContext(ctx))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var contentFormatToBlogpb = map[ContentFormat]blogpb.Blog_ContentFormat{
+	ContentPlain:    blogpb.Blog_PLAIN,
+	ContentMarkdown: blogpb.Blog_MARKDOWN,
+	ContentHTML:     blogpb.Blog_HTML,
+}
+
+var contentFormatFromBlogpb = map[blogpb.Blog_ContentFormat]ContentFormat{
+	blogpb.Blog_CONTENT_FORMAT_UNSPECIFIED: ContentPlain,
+	blogpb.Blog_PLAIN:                      ContentPlain,
+	blogpb.Blog_MARKDOWN:                   ContentMarkdown,
+	blogpb.Blog_HTML:                       ContentHTML,
+}
+
+// htmlPolicy keeps the markup that is safe to show to readers: formatting,
+// links, images and tables, without scripts, styles, event handlers or
+// javascript urls.
+var htmlPolicy = bluemonday.UGCPolicy()
+
+func contentFormat(field string, format blogpb.Blog_ContentFormat) (ContentFormat, error) {
+	cf, ok := contentFormatFromBlogpb[format]
+	if !ok {
+		return "", invalidField(field, "unknown content format: %v", format)
+	}
+
+	return cf, nil
+}
+
+// renderContent turns the content of a blog into sanitized HTML. Plain text
+// is escaped, with blank lines separating paragraphs.
+func renderContent(blog BlogItem) string {
+	switch blog.contentFormat() {
+	case ContentMarkdown:
+		return htmlPolicy.Sanitize(string(blackfriday.Run([]byte(blog.Content))))
+	case ContentHTML:
+		return htmlPolicy.Sanitize(blog.Content)
+	default:
+		return renderPlain(blog.Content)
+	}
+}
+
+func renderPlain(content string) string {
+	var b strings.Builder
+
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+
+		b.WriteString("<p>")
+		b.WriteString(strings.Join(lines, "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+
+	return b.String()
+}
+
+func (s *server) RenderBlog(ctx context.Context, req *blogpb.RenderBlogRequest) (*blogpb.RenderBlogResponse, error) {
+	log.Println("Render Blog Request RPC Call")
+
+	id := req.GetBlogId()
+
+	blogId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	blog, err := s.store.Get(ctx, blogId)
+	if err == nil && (blog.deleted() || !blog.visibleTo(viewerID(ctx))) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		return nil, storeError(err, "blog", id)
+	}
+
+	res := &blogpb.RenderBlogResponse{
+		BlogId: id,
+		Html:   renderContent(blog),
+		Etag:   formatEtag(blog.Revision),
+	}
+
+	return res, nil
+}
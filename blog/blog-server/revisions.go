@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type RevisionAction string
+
+const (
+	RevisionCreate    RevisionAction = "create"
+	RevisionUpdate    RevisionAction = "update"
+	RevisionDelete    RevisionAction = "delete"
+	RevisionUndelete  RevisionAction = "undelete"
+	RevisionRollback  RevisionAction = "rollback"
+	RevisionPublish   RevisionAction = "publish"
+	RevisionUnpublish RevisionAction = "unpublish"
+)
+
+var revisionActionToBlogpb = map[RevisionAction]blogpb.BlogRevision_Action{
+	RevisionCreate:    blogpb.BlogRevision_CREATE,
+	RevisionUpdate:    blogpb.BlogRevision_UPDATE,
+	RevisionDelete:    blogpb.BlogRevision_DELETE,
+	RevisionUndelete:  blogpb.BlogRevision_UNDELETE,
+	RevisionRollback:  blogpb.BlogRevision_ROLLBACK,
+	RevisionPublish:   blogpb.BlogRevision_PUBLISH,
+	RevisionUnpublish: blogpb.BlogRevision_UNPUBLISH,
+}
+
+// BlogRevisionItem is an entry of the append-only change history of a blog.
+type BlogRevisionItem struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	BlogID   primitive.ObjectID `bson:"blogId"`
+	Revision int64              `bson:"revision"`
+	Action   RevisionAction     `bson:"action"`
+	// Editor is the user that made the change, empty for anonymous callers.
+	Editor     string        `bson:"editor,omitempty"`
+	CreateTime time.Time     `bson:"createTime"`
+	Changes    []FieldChange `bson:"changes,omitempty"`
+	// Blog is the blog as it was right after the change.
+	Blog BlogItem `bson:"blog"`
+	// RollbackRevision is the revision restored by a rollback.
+	RollbackRevision int64 `bson:"rollbackRevision,omitempty"`
+}
+
+type FieldChange struct {
+	Field    string `bson:"field"`
+	OldValue string `bson:"oldValue"`
+	NewValue string `bson:"newValue"`
+}
+
+// historyFields are the blog fields whose changes revisions record.
+var historyFields = append(append([]string{}, mutableFields...), "state", "publish_time", "slug", "attachments")
+
+// diffBlogs lists the history fields that differ between before and after.
+func diffBlogs(before, after BlogItem) []FieldChange {
+	var changes []FieldChange
+
+	for _, field := range historyFields {
+		oldValue := fieldString(before, field)
+		newValue := fieldString(after, field)
+
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{
+				Field:    field,
+				OldValue: oldValue,
+				NewValue: newValue,
+			})
+		}
+	}
+
+	return changes
+}
+
+func fieldString(blog BlogItem, field string) string {
+	switch value := blogFields[field].get(blog).(type) {
+	case primitive.ObjectID:
+		if value.IsZero() {
+			return ""
+		}
+
+		return value.Hex()
+	case []string:
+		return strings.Join(value, ", ")
+	case []AttachmentItem:
+		filenames := make([]string, len(value))
+		for i, attachment := range value {
+			filenames[i] = attachment.Filename
+		}
+
+		return strings.Join(filenames, ", ")
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// recordRevision appends the change from before to after to the history of
+// the blog. The change itself has already been stored at this point, so a
+// failure is only logged instead of failing the call.
+func (s *server) recordRevision(ctx context.Context, action RevisionAction, before, after BlogItem, rollbackRevision int64) {
+	err := s.store.AddRevision(ctx, BlogRevisionItem{
+		ID:               primitive.NewObjectID(),
+		BlogID:           after.ID,
+		Revision:         after.Revision,
+		Action:           action,
+		Editor:           callerID(ctx),
+		CreateTime:       timeNow(),
+		Changes:          diffBlogs(before, after),
+		Blog:             after,
+		RollbackRevision: rollbackRevision,
+	})
+	if err != nil {
+		log.Printf("Error while recording revision %v of blog %v: %v", after.Revision, after.ID.Hex(), err)
+	}
+}
+
+func blogRevisionItemToBlogpb(rI BlogRevisionItem) *blogpb.BlogRevision {
+	rev := &blogpb.BlogRevision{
+		BlogId:           rI.BlogID.Hex(),
+		Revision:         rI.Revision,
+		Action:           revisionActionToBlogpb[rI.Action],
+		Editor:           rI.Editor,
+		CreateTime:       timestamppb.New(rI.CreateTime),
+		Blog:             blogItemToBlogpb(rI.Blog),
+		RollbackRevision: rI.RollbackRevision,
+	}
+
+	for _, change := range rI.Changes {
+		rev.Changes = append(rev.Changes, &blogpb.FieldChange{
+			Field:    change.Field,
+			OldValue: change.OldValue,
+			NewValue: change.NewValue,
+		})
+	}
+
+	return rev
+}
+
+// revisionBlog checks that the blog with the given id exists and is visible
+// to the caller, the history of deleted blogs is kept until they are purged.
+func (s *server) revisionBlog(ctx context.Context, id string) (primitive.ObjectID, error) {
+	blogId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	blog, err := s.store.Get(ctx, blogId)
+	if err == nil && !blog.visibleTo(viewerID(ctx)) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		return primitive.NilObjectID, storeError(err, "blog", id)
+	}
+
+	return blogId, nil
+}
+
+func (s *server) ListBlogRevisions(ctx context.Context, req *blogpb.ListBlogRevisionsRequest) (*blogpb.ListBlogRevisionsResponse, error) {
+	log.Println("List Blog Revisions Request RPC Call")
+
+	id := req.GetBlogId()
+
+	blogId, err := s.revisionBlog(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := req.GetPageSize()
+	if pageSize < 0 {
+		return nil, invalidField("page_size", "page size must not be negative: %v", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	before, err := decodeRevisionPageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch one extra revision to find out whether there is a next page
+	revs, err := s.store.ListRevisions(ctx, blogId, before, int64(pageSize)+1)
+	if err != nil {
+		return nil, storeError(err, "blog", id)
+	}
+
+	res := &blogpb.ListBlogRevisionsResponse{}
+
+	if len(revs) > int(pageSize) {
+		revs = revs[:pageSize]
+		res.NextPageToken = encodeRevisionPageToken(revs[len(revs)-1].Revision)
+	}
+
+	for _, rev := range revs {
+		res.Revisions = append(res.Revisions, blogRevisionItemToBlogpb(rev))
+	}
+
+	return res, nil
+}
+
+func (s *server) GetBlogRevision(ctx context.Context, req *blogpb.GetBlogRevisionRequest) (*blogpb.GetBlogRevisionResponse, error) {
+	log.Println("Get Blog Revision Request RPC Call")
+
+	id := req.GetBlogId()
+
+	blogId, err := s.revisionBlog(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := s.store.GetRevision(ctx, blogId, req.GetRevision())
+	if err != nil {
+		return nil, storeError(err, "revision", revisionName(id, req.GetRevision()))
+	}
+
+	res := &blogpb.GetBlogRevisionResponse{
+		Revision: blogRevisionItemToBlogpb(rev),
+	}
+
+	return res, nil
+}
+
+func (s *server) RollbackBlog(ctx context.Context, req *blogpb.RollbackBlogRequest) (*blogpb.RollbackBlogResponse, error) {
+	log.Println("Rollback Blog Request RPC Call")
+
+	id := req.GetBlogId()
+
+	blogId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
+	}
+
+	revision, err := parseEtag("etag", req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := s.store.GetRevision(ctx, blogId, req.GetRevision())
+	if err != nil {
+		return nil, storeError(err, "revision", revisionName(id, req.GetRevision()))
+	}
+
+	data := rev.Blog
+	data.UpdateTime = timeNow()
+
+	result, err := s.store.Update(ctx, blogId, BlogUpdate{
+		Blog:     data,
+		Fields:   append(append([]string{}, mutableFields...), "update_time"),
+		Revision: revision,
+	})
+	if err != nil {
+		return nil, storeError(err, "blog", id)
+	}
+
+	s.recordRevision(ctx, RevisionRollback, result.Before, result.Blog, rev.Revision)
+
+	res := &blogpb.RollbackBlogResponse{
+		Blog: blogItemToBlogpb(result.Blog),
+	}
+
+	return res, nil
+}
+
+// revisionName identifies a revision of a blog in errors.
+func revisionName(blogId string, revision int64) string {
+	return blogId + "/" + strconv.FormatInt(revision, 10)
+}
+
+// Revision page tokens hold the revision the next page starts below.
+func encodeRevisionPageToken(before int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(before, 10)))
+}
+
+func decodeRevisionPageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, invalidField("page_token", "invalid page token: %v", token)
+	}
+
+	before, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || before <= 0 {
+		return 0, invalidField("page_token", "invalid page token: %v", token)
+	}
+
+	return before, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+
+	// titleWeight is how much more a word in the title counts than one in the
+	// content, for both the mongo text index and the in-memory index.
+	titleWeight = 5
+
+	// snippetWords is the number of words of content kept around the first
+	// match in a content snippet.
+	snippetWords = 30
+)
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// SearchHit is a blog matching a search query together with its relevance.
+type SearchHit struct {
+	Blog  BlogItem
+	Score float64
+}
+
+// tokenize splits text into lower case words.
+func tokenize(text string) []string {
+	words := wordPattern.FindAllString(text, -1)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+
+	return words
+}
+
+// queryTerms returns the distinct words of a search query.
+func queryTerms(query string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, word := range tokenize(query) {
+		terms[word] = true
+	}
+
+	return terms
+}
+
+// highlight html escapes text and wraps every word contained in terms in
+// <em></em>. When maxWords is positive only a window of that many words around
+// the first match is kept.
+func highlight(text string, terms map[string]bool, maxWords int) string {
+	words := wordPattern.FindAllStringIndex(text, -1)
+
+	start, end := 0, len(words)
+	if maxWords > 0 && len(words) > maxWords {
+		first := 0
+		for i, loc := range words {
+			if terms[strings.ToLower(text[loc[0]:loc[1]])] {
+				first = i
+				break
+			}
+		}
+
+		start = first - maxWords/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + maxWords
+		if end > len(words) {
+			end = len(words)
+			start = end - maxWords
+		}
+	}
+
+	var b strings.Builder
+
+	offset := 0
+	if start > 0 {
+		b.WriteString("…")
+		offset = words[start][0]
+	}
+
+	for _, loc := range words[start:end] {
+		b.WriteString(html.EscapeString(text[offset:loc[0]]))
+
+		word := text[loc[0]:loc[1]]
+		if terms[strings.ToLower(word)] {
+			b.WriteString("<em>" + html.EscapeString(word) + "</em>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+
+		offset = loc[1]
+	}
+
+	if end < len(words) {
+		b.WriteString(html.EscapeString(text[offset:words[end][0]]))
+		b.WriteString("…")
+	} else {
+		b.WriteString(html.EscapeString(text[offset:]))
+	}
+
+	return b.String()
+}
+
+// invertedIndex is the search index of the in-memory store. It is not safe for
+// concurrent use on its own, memoryStore guards it with its lock.
+type invertedIndex struct {
+	// postings maps every word to the weighted number of times it appears in
+	// each blog.
+	postings map[string]map[primitive.ObjectID]float64
+	// terms remembers the words indexed per blog so they can be removed again.
+	terms map[primitive.ObjectID][]string
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: make(map[string]map[primitive.ObjectID]float64),
+		terms:    make(map[primitive.ObjectID][]string),
+	}
+}
+
+func (idx *invertedIndex) add(blog BlogItem) {
+	idx.remove(blog.ID)
+
+	freq := make(map[string]float64)
+	for _, word := range tokenize(blog.Title) {
+		freq[word] += titleWeight
+	}
+	for _, word := range tokenize(blog.Content) {
+		freq[word]++
+	}
+
+	terms := make([]string, 0, len(freq))
+	for word, f := range freq {
+		if idx.postings[word] == nil {
+			idx.postings[word] = make(map[primitive.ObjectID]float64)
+		}
+		idx.postings[word][blog.ID] = f
+		terms = append(terms, word)
+	}
+
+	idx.terms[blog.ID] = terms
+}
+
+func (idx *invertedIndex) remove(id primitive.ObjectID) {
+	for _, word := range idx.terms[id] {
+		delete(idx.postings[word], id)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+		}
+	}
+
+	delete(idx.terms, id)
+}
+
+// search scores every blog containing at least one of terms with tf-idf and
+// returns their ids ordered by descending score.
+func (idx *invertedIndex) search(terms map[string]bool) ([]primitive.ObjectID, map[primitive.ObjectID]float64) {
+	docs := float64(len(idx.terms))
+	scores := make(map[primitive.ObjectID]float64)
+
+	for term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + docs/float64(len(postings)))
+		for id, f := range postings {
+			scores[id] += f * idf
+		}
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+
+		return compareValues(ids[i], ids[j]) < 0
+	})
+
+	return ids, scores
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"time"
@@ -15,153 +13,196 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type server struct {
 	blogpb.UnimplementedBlogServiceServer
+
+	store       BlogStore
+	comments    CommentStore
+	authors     AuthorStore
+	attachments AttachmentStore
+
+	// tenants are the tenants background jobs run for, nil when the stores
+	// are not split into tenants
+	tenants *tenantRegistry
 }
 
-func (*server) CreateBlog(ctx context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
+func (s *server) CreateBlog(ctx context.Context, req *blogpb.CreateBlogRequest) (*blogpb.CreateBlogResponse, error) {
 	log.Println("Create Blog Request RPC Call")
 
-	blog := req.GetBlog()
-
-	authorId, err := primitive.ObjectIDFromHex(blog.GetAuthorId())
+	data, err := newBlogItem(req.GetBlog(), timeNow())
 	if err != nil {
 		return nil, err
 	}
 
-	data := BlogItem{
-		ID:       primitive.NewObjectID(),
-		AuthorID: authorId,
-		Title:    blog.GetTitle(),
-		Content:  blog.GetContent(),
+	err = s.checkAuthor(ctx, data.AuthorID)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = collection.InsertOne(ctx, data)
+	blog, err := s.createBlog(ctx, data)
 	if err != nil {
-		return nil, err
+		return nil, storeError(err, "blog", data.ID.Hex())
 	}
 
+	s.recordRevision(ctx, RevisionCreate, BlogItem{}, blog, 0)
+
 	res := &blogpb.CreateBlogResponse{
-		Blog: blogItemToBlogpb(data),
+		Blog: blogItemToBlogpb(blog),
 	}
 
 	return res, nil
 }
-func (*server) ReadBlog(ctx context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
+func (s *server) ReadBlog(ctx context.Context, req *blogpb.ReadBlogRequest) (*blogpb.ReadBlogResponse, error) {
 	log.Println("Read Blog Request RPC Call")
 
 	id := req.GetBlogId()
 
 	blogId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "the provided id: %v is not a objectid string", id)
+		return nil, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
 	}
 
-	result := collection.FindOne(ctx, primitive.M{
-		"_id": blogId,
-	})
-
-	if result.Err() == mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.NotFound, "Blog with the id: %v not found", id)
+	blog, err := s.store.Get(ctx, blogId)
+	if err == nil && ((blog.deleted() && !req.GetShowDeleted()) || !blog.visibleTo(viewerID(ctx))) {
+		err = errBlogNotFound
 	}
-
-	var blog BlogItem
-
-	err = result.Decode(&blog)
 	if err != nil {
-		return nil, err
+		return nil, storeError(err, "blog", id)
 	}
 
 	res := &blogpb.ReadBlogResponse{
 		Blog: blogItemToBlogpb(blog),
 	}
 
+	if req.GetIncludeAuthor() {
+		res.Author, err = s.authorSummary(ctx, blog.AuthorID)
+		if err != nil {
+			return nil, storeError(err, "author", blog.AuthorID.Hex())
+		}
+	}
+
 	return res, nil
 }
-func (*server) UpdateBlog(ctx context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
+func (s *server) UpdateBlog(ctx context.Context, req *blogpb.UpdateBlogRequest) (*blogpb.UpdateBlogResponse, error) {
 	log.Println("Update Blog Request RPC Call")
 
 	blog := req.GetBlog()
 
 	blogId, err := primitive.ObjectIDFromHex(blog.GetId())
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "Can not parse ID from string to objectId")
+		return nil, invalidField("blog.id", "Can not parse ID from string to objectId")
 	}
 
-	data := BlogItem{}
+	fields, err := updateFields(blog, req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
 
-	if blog.GetAuthorId() != "" {
-		authorId, err := primitive.ObjectIDFromHex(blog.GetAuthorId())
-		if err != nil {
-			return nil, err
-		}
+	revision, err := parseEtag("blog.etag", blog.GetEtag())
+	if err != nil {
+		return nil, err
+	}
 
-		data.AuthorID = authorId
+	tags, err := normalizeTags("blog.tags", blog.GetTags())
+	if err != nil {
+		return nil, err
 	}
 
-	if blog.GetTitle() != "" {
-		data.Title = blog.GetTitle()
+	format, err := contentFormat("blog.content_format", blog.GetContentFormat())
+	if err != nil {
+		return nil, err
 	}
 
-	if blog.GetContent() != "" {
-		data.Content = blog.GetContent()
+	data := BlogItem{
+		Title:         blog.GetTitle(),
+		Content:       blog.GetContent(),
+		ContentFormat: format,
+		Tags:          tags,
+		UpdateTime:    timeNow(),
 	}
 
-	after := options.After
-	upsert := true
-	opt := &options.FindOneAndUpdateOptions{
-		ReturnDocument: &after,
-		Upsert:         &upsert,
+	// a blog created by the update needs what CreateBlog requires, the
+	// author is checked below
+	if req.GetAllowMissing() && revision == nil {
+		if !containsString(fields, "author_id") || blog.GetAuthorId() == "" {
+			return nil, invalidField("blog.author_id", "the author id is required when the blog may be created")
+		}
+
+		if !containsString(fields, "title") || blog.GetTitle() == "" {
+			return nil, invalidField("blog.title", "the title is required when the blog may be created")
+		}
 	}
 
-	result := collection.FindOneAndUpdate(ctx, primitive.M{
-		"_id": blogId,
-	}, primitive.M{
-		"$set": data,
-	}, opt)
-	if result.Err() != nil {
-		if result.Err() == mongo.ErrNoDocuments {
-			return nil, status.Errorf(codes.NotFound, "Blog with the id: %v not found", blog.GetId())
+	if containsString(fields, "author_id") {
+		data.AuthorID, err = primitive.ObjectIDFromHex(blog.GetAuthorId())
+		if err != nil {
+			return nil, invalidField("blog.author_id", "the provided author id: %v is not a objectid string", blog.GetAuthorId())
 		}
 
-		return nil, err
+		err = s.checkAuthor(ctx, data.AuthorID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	var blogRes BlogItem
+	slugTitle, err := s.slugTitle(ctx, blogId, req, data.Title, containsString(fields, "title"))
+	if err != nil {
+		return nil, storeError(err, "blog", blog.GetId())
+	}
 
-	err = result.Decode(&blogRes)
+	result, err := s.updateBlog(ctx, blogId, BlogUpdate{
+		Blog:         data,
+		Fields:       append(fields, "update_time"),
+		Revision:     revision,
+		AllowMissing: req.GetAllowMissing(),
+	}, slugTitle)
+	if err == errBlogExists {
+		return nil, errorWithInfo(codes.AlreadyExists, "BLOG_DELETED", "blog", blog.GetId(), "Blog with the id: %v is deleted, undelete it before updating it", blog.GetId())
+	}
 	if err != nil {
-		return nil, err
+		return nil, storeError(err, "blog", blog.GetId())
 	}
 
+	action := RevisionUpdate
+	if result.Created {
+		action = RevisionCreate
+	}
+	s.recordRevision(ctx, action, result.Before, result.Blog, 0)
+
 	res := &blogpb.UpdateBlogResponse{
-		Blog: blogItemToBlogpb(blogRes),
+		Blog:    blogItemToBlogpb(result.Blog),
+		Created: result.Created,
 	}
 
 	return res, nil
 }
 
-func (*server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
-	log.Println("Read Blog Request RPC Call")
+func (s *server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*blogpb.DeleteBlogResponse, error) {
+	log.Println("Delete Blog Request RPC Call")
 
 	id := req.GetBlogId()
 
 	blogId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "the provided id: %v is not a objectid string", id)
+		return nil, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
 	}
 
-	result := collection.FindOneAndDelete(ctx, primitive.M{
-		"_id": blogId,
-	})
+	revision, err := parseEtag("etag", req.GetEtag())
+	if err != nil {
+		return nil, err
+	}
 
-	if result.Err() == mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.NotFound, "Blog with the id: %v not found", id)
+	deleted, err := s.store.Delete(ctx, blogId, revision, timeNow())
+	if err != nil {
+		return nil, storeError(err, "blog", id)
 	}
 
+	s.recordRevision(ctx, RevisionDelete, deleted, deleted, 0)
+
 	res := &blogpb.DeleteBlogResponse{
 		BlogId: id,
 	}
@@ -169,74 +210,283 @@ func (*server) DeleteBlog(ctx context.Context, req *blogpb.DeleteBlogRequest) (*
 	return res, nil
 }
 
-func (*server) ListBlog(_ *blogpb.ListBlogRequest, wStream blogpb.BlogService_ListBlogServer) error {
-	var blog BlogItem
+func (s *server) UndeleteBlog(ctx context.Context, req *blogpb.UndeleteBlogRequest) (*blogpb.UndeleteBlogResponse, error) {
+	log.Println("Undelete Blog Request RPC Call")
+
+	id := req.GetBlogId()
 
-	blogCursor, err := collection.Find(context.Background(), primitive.M{})
+	blogId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return status.Errorf(codes.Internal, fmt.Sprintf("error while trying to retrieve cursor: %v", err))
+		return nil, invalidField("blog_id", "the provided id: %v is not a objectid string", id)
 	}
-	defer blogCursor.Close(context.Background())
 
-	for blogCursor.Next(context.Background()) {
-		err = blogCursor.Decode(&blog)
-		if err != nil {
-			return status.Errorf(codes.Internal, fmt.Sprintf("error while decoding data from MongoDB: %v", err))
-		}
+	blog, err := s.store.Undelete(ctx, blogId)
+	if err != nil {
+		return nil, storeError(err, "blog", id)
+	}
+
+	s.recordRevision(ctx, RevisionUndelete, blog, blog, 0)
+
+	res := &blogpb.UndeleteBlogResponse{
+		Blog: blogItemToBlogpb(blog),
+	}
+
+	return res, nil
+}
 
-		wStream.Send(&blogpb.ListBlogResponse{
+func (s *server) ListBlog(req *blogpb.ListBlogRequest, wStream blogpb.BlogService_ListBlogServer) error {
+	log.Println("List Blog Request RPC Call")
+
+	nextPageToken, err := s.listPage(wStream.Context(), req, 0, func(blog BlogItem) error {
+		return wStream.Send(&blogpb.ListBlogResponse{
 			Blog: blogItemToBlogpb(blog),
 		})
+	})
+	if err != nil {
+		return storeError(err, "blog", "")
 	}
 
-	if blogCursor.Err() != nil {
-		return status.Errorf(codes.Internal, fmt.Sprintf("unknown internal error: %v", blogCursor.Err()))
-	}
+	wStream.SetTrailer(metadata.Pairs(nextPageTrailer, nextPageToken))
 
 	return nil
 }
 
-func blogItemToBlogpb(bI BlogItem) *blogpb.Blog {
-	return &blogpb.Blog{
-		Id:       bI.ID.Hex(),
-		AuthorId: bI.AuthorID.Hex(),
-		Title:    bI.Title,
-		Content:  bI.Content,
+func (s *server) ListBlogPage(ctx context.Context, req *blogpb.ListBlogRequest) (*blogpb.ListBlogPageResponse, error) {
+	log.Println("List Blog Page Request RPC Call")
+
+	res := &blogpb.ListBlogPageResponse{}
+
+	nextPageToken, err := s.listPage(ctx, req, defaultPageSize, func(blog BlogItem) error {
+		res.Blogs = append(res.Blogs, blogItemToBlogpb(blog))
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err, "blog", "")
 	}
+
+	res.NextPageToken = nextPageToken
+
+	return res, nil
 }
 
-type BlogItem struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	AuthorID primitive.ObjectID `bson:"authorId,omitempty"`
-	Content  string             `bson:"content,omitempty"`
-	Title    string             `bson:"title,omitempty"`
+func (s *server) SearchBlogs(ctx context.Context, req *blogpb.SearchBlogsRequest) (*blogpb.SearchBlogsResponse, error) {
+	log.Println("Search Blogs Request RPC Call")
+
+	terms := queryTerms(req.GetQuery())
+	if len(terms) == 0 {
+		return nil, invalidField("query", "the search query must contain at least one word")
+	}
+
+	limit := req.GetPageSize()
+	if limit < 0 {
+		return nil, invalidField("page_size", "page size must not be negative: %v", limit)
+	}
+	if limit == 0 {
+		limit = defaultSearchResults
+	}
+	if limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+
+	hits, err := s.store.Search(ctx, req.GetQuery(), viewerID(ctx), int64(limit))
+	if err != nil {
+		return nil, storeError(err, "blog", "")
+	}
+
+	res := &blogpb.SearchBlogsResponse{}
+	for _, hit := range hits {
+		res.Results = append(res.Results, &blogpb.SearchBlogsResult{
+			Blog:           blogItemToBlogpb(hit.Blog),
+			Score:          hit.Score,
+			TitleSnippet:   highlight(hit.Blog.Title, terms, 0),
+			ContentSnippet: highlight(hit.Blog.Content, terms, snippetWords),
+		})
+	}
+
+	return res, nil
 }
 
-var collection *mongo.Collection
+// newBlogItem turns a blog sent by a client into a new BlogItem created at
+// now, ignoring every server managed field.
+func newBlogItem(blog *blogpb.Blog, now time.Time) (BlogItem, error) {
+	authorId, err := primitive.ObjectIDFromHex(blog.GetAuthorId())
+	if err != nil {
+		return BlogItem{}, invalidField("blog.author_id", "the provided author id: %v is not a objectid string", blog.GetAuthorId())
+	}
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	tags, err := normalizeTags("blog.tags", blog.GetTags())
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	format, err := contentFormat("blog.content_format", blog.GetContentFormat())
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return BlogItem{
+		ID:            primitive.NewObjectID(),
+		AuthorID:      authorId,
+		Title:         blog.GetTitle(),
+		Content:       blog.GetContent(),
+		ContentFormat: format,
+		Tags:          tags,
+		CreateTime:    now,
+		UpdateTime:    now,
+		Revision:      1,
+		State:         StateDraft,
+	}, nil
+}
+
+func blogItemToBlogpb(bI BlogItem) *blogpb.Blog {
+	blog := &blogpb.Blog{
+		Id:            bI.ID.Hex(),
+		AuthorId:      bI.AuthorID.Hex(),
+		Title:         bI.Title,
+		Slug:          bI.Slug,
+		Content:       bI.Content,
+		ContentFormat: contentFormatToBlogpb[bI.contentFormat()],
+		Etag:          formatEtag(bI.Revision),
+		Tags:          bI.Tags,
+		State:         blogStateToBlogpb[bI.state()],
+	}
+
+	if !bI.CreateTime.IsZero() {
+		blog.CreateTime = timestamppb.New(bI.CreateTime)
+	}
+
+	if !bI.UpdateTime.IsZero() {
+		blog.UpdateTime = timestamppb.New(bI.UpdateTime)
+	}
+
+	if bI.deleted() {
+		blog.DeleteTime = timestamppb.New(bI.DeleteTime)
+	}
+
+	if !bI.PublishTime.IsZero() {
+		blog.PublishTime = timestamppb.New(bI.PublishTime)
+	}
+
+	for _, attachment := range bI.Attachments {
+		blog.Attachments = append(blog.Attachments, attachmentItemToBlogpb(attachment))
+	}
+
+	return blog
+}
 
+// timeNow returns the current time in the millisecond precision mongodb
+// stores, so freshly written blogs look the same as once read back.
+func timeNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// connectMongo connects to mongodb and returns the registered tenants, which
+// have a database of their own besides the default one.
+func connectMongo(cfg blogConfig) (*mongo.Client, []string) {
 	log.Println("Connecting to mongodb")
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
 		log.Panicln("Error while trying to connect to mongo")
 	}
 
-	collection = client.Database("grpc-go-course").Collection("blog")
+	existing, err := mongoTenants(ctx, client, cfg.Database)
+	if err != nil {
+		log.Fatalln("Error while listing the registered tenants", err)
+	}
+
+	return client, existing
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	cfg, err := loadConfig("", os.Args[1:])
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
+
+	var open func(ctx context.Context, tenant string) (*tenantStores, error)
+	var existing []string
+	var client *mongo.Client
+
+	switch cfg.Store {
+	case "mongo":
+		client, existing = connectMongo(cfg)
+
+		if cfg.AutoMigrate {
+			// migrate the known tenants up front, without the deadline of a
+			// call, listed tenants not registered yet are migrated when
+			// they are first called for
+			err = migrateTenants(context.Background(), client, cfg.Database, append([]string{defaultTenant}, existing...), false)
+			if err != nil {
+				log.Fatalln("Error while migrating the databases", err)
+			}
+		}
+
+		open = openMongoTenant(client, cfg.Database, cfg.AutoMigrate)
+	case "memory":
+		log.Println("Using in-memory storage")
+		open = openMemoryTenant(cfg.AttachmentDir)
+	}
+
+	tenants := newTenantRegistry(open, cfg.Tenants, cfg.ConnectTimeout)
+	for _, tenant := range existing {
+		tenants.add(tenant)
+	}
+
+	// fail on startup rather than on the first call if the stores of the
+	// default tenant can not be opened
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	_, err = tenants.get(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalln("Error while opening the stores", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	srv := &server{
+		store:       tenantBlogStore{tenants},
+		comments:    tenantCommentStore{tenants},
+		authors:     tenantAuthorStore{tenants},
+		attachments: tenantAttachmentStore{tenants},
+		tenants:     tenants,
+	}
+
+	if cfg.TrashRetention > 0 {
+		go srv.runPurger(backgroundCtx, cfg.TrashRetention, cfg.PurgeInterval)
+	}
+
+	go srv.runScheduler(backgroundCtx, systemClock{}, cfg.ScheduleInterval)
 
 	log.Println("Blog Service Started")
-	mux, err := net.Listen("tcp", ":6543")
+	mux, err := cfg.Listen()
 	if err != nil {
 		log.Fatal("failed to listen", err)
 	}
 
-	s := grpc.NewServer()
+	opts, err := cfg.Options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	s := grpc.NewServer(append(opts,
+		grpc.ChainUnaryInterceptor(tenants.unaryInterceptor, validationUnaryInterceptor),
+		grpc.ChainStreamInterceptor(tenants.streamInterceptor, validationStreamInterceptor),
+	)...)
 	defer s.Stop()
 
-	blogpb.RegisterBlogServiceServer(s, &server{})
+	blogpb.RegisterBlogServiceServer(s, srv)
+	blogpb.RegisterAuthorServiceServer(s, &authorServer{authors: srv.authors})
 
 	go func() {
 		err = s.Serve(mux)
@@ -252,9 +502,12 @@ func main() {
 
 	log.Println("Stopping the server")
 	s.Stop()
+	stopBackground()
 
-	log.Println("close mongodb connection")
-	client.Disconnect(context.Background())
+	if client != nil {
+		log.Println("close mongodb connection")
+		client.Disconnect(context.Background())
+	}
 
 	log.Println("Closing the listener")
 	mux.Close()
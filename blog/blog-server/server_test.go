@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a server wired to the in-memory stores of the default
+// tenant like main does, a live and a deleted blog, and a context calling as
+// their author.
+func newTestServer(t *testing.T) (*server, context.Context, *blogpb.Blog, *blogpb.Blog) {
+	t.Helper()
+
+	registry := newTenantRegistry(openMemoryTenant(t.TempDir()), nil, time.Minute)
+	s := &server{
+		store:       tenantBlogStore{registry},
+		comments:    tenantCommentStore{registry},
+		authors:     tenantAuthorStore{registry},
+		attachments: tenantAttachmentStore{registry},
+		tenants:     registry,
+	}
+
+	author, err := s.authors.CreateAuthor(context.Background(), AuthorItem{
+		ID:          primitive.NewObjectID(),
+		DisplayName: "Author",
+		CreateTime:  timeNow(),
+		UpdateTime:  timeNow(),
+	})
+	if err != nil {
+		t.Fatalf("CreateAuthor failed: %v", err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(userMetadataKey, author.ID.Hex()))
+
+	var blogs []*blogpb.Blog
+	for _, title := range []string{"Live", "Gone"} {
+		res, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{
+			Blog: &blogpb.Blog{AuthorId: author.ID.Hex(), Title: title, Content: "Content of " + title},
+		})
+		if err != nil {
+			t.Fatalf("CreateBlog(%v) failed: %v", title, err)
+		}
+
+		blogs = append(blogs, res.GetBlog())
+	}
+
+	_, err = s.DeleteBlog(ctx, &blogpb.DeleteBlogRequest{BlogId: blogs[1].GetId()})
+	if err != nil {
+		t.Fatalf("DeleteBlog failed: %v", err)
+	}
+
+	return s, ctx, blogs[0], blogs[1]
+}
+
+// errorReason returns the reason of the ErrorInfo detail of err.
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+
+	return ""
+}
+
+func TestCreateBlog(t *testing.T) {
+	s, ctx, live, _ := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		blog     *blogpb.Blog
+		wantCode codes.Code
+	}{
+		{"valid", &blogpb.Blog{AuthorId: live.GetAuthorId(), Title: "New"}, codes.OK},
+		{"same title", &blogpb.Blog{AuthorId: live.GetAuthorId(), Title: live.GetTitle()}, codes.OK},
+		{"invalid author id", &blogpb.Blog{AuthorId: "nope", Title: "New"}, codes.InvalidArgument},
+		{"missing author", &blogpb.Blog{AuthorId: primitive.NewObjectID().Hex(), Title: "New"}, codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{Blog: tt.blog})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("CreateBlog() error = %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: res.GetBlog().GetId()})
+			if err != nil {
+				t.Fatalf("ReadBlog() error = %v", err)
+			}
+			if read.GetBlog().GetTitle() != tt.blog.GetTitle() || read.GetBlog().GetState() != blogpb.Blog_DRAFT {
+				t.Errorf("ReadBlog() = %v, want a draft titled %q", read.GetBlog(), tt.blog.GetTitle())
+			}
+			if read.GetBlog().GetSlug() == live.GetSlug() {
+				t.Errorf("slug %q is the one of another blog", read.GetBlog().GetSlug())
+			}
+		})
+	}
+}
+
+func TestReadBlog(t *testing.T) {
+	s, ctx, live, gone := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		req      *blogpb.ReadBlogRequest
+		wantCode codes.Code
+	}{
+		{"live", &blogpb.ReadBlogRequest{BlogId: live.GetId()}, codes.OK},
+		{"deleted", &blogpb.ReadBlogRequest{BlogId: gone.GetId()}, codes.NotFound},
+		{"deleted shown", &blogpb.ReadBlogRequest{BlogId: gone.GetId(), ShowDeleted: true}, codes.OK},
+		{"missing", &blogpb.ReadBlogRequest{BlogId: primitive.NewObjectID().Hex()}, codes.NotFound},
+		{"invalid id", &blogpb.ReadBlogRequest{BlogId: "nope"}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.ReadBlog(ctx, tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("ReadBlog() error = %v, want %v", err, tt.wantCode)
+			}
+			if err == nil && res.GetBlog().GetId() != tt.req.GetBlogId() {
+				t.Errorf("ReadBlog() = %v, want the blog %v", res.GetBlog(), tt.req.GetBlogId())
+			}
+		})
+	}
+}
+
+func TestUpdateBlog(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest
+		wantCode    codes.Code
+		wantReason  string
+		wantCreated bool
+	}{
+		{
+			name: "title",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: live.GetId(), Title: "Changed"}}
+			},
+		},
+		{
+			name: "current etag",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: live.GetId(), Title: "Changed", Etag: live.GetEtag()}}
+			},
+		},
+		{
+			name: "stale etag",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: live.GetId(), Title: "Changed", Etag: `"7"`}}
+			},
+			wantCode:   codes.Aborted,
+			wantReason: "ETAG_MISMATCH",
+		},
+		{
+			name: "missing",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: primitive.NewObjectID().Hex(), Title: "Changed"}}
+			},
+			wantCode:   codes.NotFound,
+			wantReason: "NOT_FOUND",
+		},
+		{
+			name: "missing allowed",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{
+					Blog:         &blogpb.Blog{Id: primitive.NewObjectID().Hex(), AuthorId: live.GetAuthorId(), Title: "Created"},
+					AllowMissing: true,
+				}
+			},
+			wantCreated: true,
+		},
+		{
+			name: "missing allowed without a title",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{
+					Blog:         &blogpb.Blog{Id: primitive.NewObjectID().Hex(), AuthorId: live.GetAuthorId(), Content: "Created"},
+					AllowMissing: true,
+				}
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "deleted",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: gone.GetId(), Title: "Changed"}}
+			},
+			wantCode:   codes.NotFound,
+			wantReason: "NOT_FOUND",
+		},
+		{
+			name: "deleted with missing allowed",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{
+					Blog:         &blogpb.Blog{Id: gone.GetId(), AuthorId: gone.GetAuthorId(), Title: "Changed"},
+					AllowMissing: true,
+				}
+			},
+			wantCode:   codes.AlreadyExists,
+			wantReason: "BLOG_DELETED",
+		},
+		{
+			name: "missing author",
+			req: func(live, gone *blogpb.Blog) *blogpb.UpdateBlogRequest {
+				return &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: live.GetId(), AuthorId: primitive.NewObjectID().Hex()}}
+			},
+			wantCode:   codes.FailedPrecondition,
+			wantReason: "AUTHOR_NOT_FOUND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ctx, live, gone := newTestServer(t)
+			req := tt.req(live, gone)
+
+			res, err := s.UpdateBlog(ctx, req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("UpdateBlog() error = %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				if reason := errorReason(err); tt.wantReason != "" && reason != tt.wantReason {
+					t.Errorf("UpdateBlog() reason = %v, want %v", reason, tt.wantReason)
+				}
+				return
+			}
+
+			if res.GetCreated() != tt.wantCreated {
+				t.Errorf("UpdateBlog() created = %v, want %v", res.GetCreated(), tt.wantCreated)
+			}
+			if res.GetBlog().GetTitle() != req.GetBlog().GetTitle() {
+				t.Errorf("UpdateBlog() title = %q, want %q", res.GetBlog().GetTitle(), req.GetBlog().GetTitle())
+			}
+
+			read, err := s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: req.GetBlog().GetId()})
+			if err != nil {
+				t.Fatalf("ReadBlog() error = %v", err)
+			}
+			if read.GetBlog().GetEtag() != res.GetBlog().GetEtag() {
+				t.Errorf("ReadBlog() etag = %v, want %v", read.GetBlog().GetEtag(), res.GetBlog().GetEtag())
+			}
+		})
+	}
+}
+
+func TestDeleteBlog(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest
+		wantCode codes.Code
+	}{
+		{"live", func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest {
+			return &blogpb.DeleteBlogRequest{BlogId: live.GetId()}
+		}, codes.OK},
+		{"current etag", func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest {
+			return &blogpb.DeleteBlogRequest{BlogId: live.GetId(), Etag: live.GetEtag()}
+		}, codes.OK},
+		{"stale etag", func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest {
+			return &blogpb.DeleteBlogRequest{BlogId: live.GetId(), Etag: `"7"`}
+		}, codes.Aborted},
+		{"deleted", func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest {
+			return &blogpb.DeleteBlogRequest{BlogId: gone.GetId()}
+		}, codes.NotFound},
+		{"missing", func(live, gone *blogpb.Blog) *blogpb.DeleteBlogRequest {
+			return &blogpb.DeleteBlogRequest{BlogId: primitive.NewObjectID().Hex()}
+		}, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ctx, live, gone := newTestServer(t)
+			req := tt.req(live, gone)
+
+			_, err := s.DeleteBlog(ctx, req)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("DeleteBlog() error = %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			_, err = s.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: req.GetBlogId()})
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("ReadBlog() of the deleted blog error = %v, want %v", err, codes.NotFound)
+			}
+
+			// deleted blogs can be restored once
+			_, err = s.UndeleteBlog(ctx, &blogpb.UndeleteBlogRequest{BlogId: req.GetBlogId()})
+			if err != nil {
+				t.Fatalf("UndeleteBlog() error = %v", err)
+			}
+			_, err = s.UndeleteBlog(ctx, &blogpb.UndeleteBlogRequest{BlogId: req.GetBlogId()})
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("UndeleteBlog() of a restored blog error = %v, want %v", err, codes.FailedPrecondition)
+			}
+		})
+	}
+}
+
+func TestListBlogPage(t *testing.T) {
+	s, ctx, live, gone := newTestServer(t)
+
+	published, err := s.CreateBlog(ctx, &blogpb.CreateBlogRequest{
+		Blog: &blogpb.Blog{AuthorId: live.GetAuthorId(), Title: "Published"},
+	})
+	if err != nil {
+		t.Fatalf("CreateBlog() error = %v", err)
+	}
+	_, err = s.PublishBlog(ctx, &blogpb.PublishBlogRequest{BlogId: published.GetBlog().GetId()})
+	if err != nil {
+		t.Fatalf("PublishBlog() error = %v", err)
+	}
+
+	anonymous := context.Background()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *blogpb.ListBlogRequest
+		want []string
+	}{
+		{"author", ctx, &blogpb.ListBlogRequest{OrderBy: "title"}, []string{"Live", "Published"}},
+		{"anonymous", anonymous, &blogpb.ListBlogRequest{OrderBy: "title"}, []string{"Published"}},
+		{"show deleted", ctx, &blogpb.ListBlogRequest{OrderBy: "title", ShowDeleted: true}, []string{"Gone", "Live", "Published"}},
+		{"only deleted", ctx, &blogpb.ListBlogRequest{OnlyDeleted: true}, []string{gone.GetTitle()}},
+		{"title prefix", ctx, &blogpb.ListBlogRequest{TitlePrefix: "Pub"}, []string{"Published"}},
+		{"page size", ctx, &blogpb.ListBlogRequest{OrderBy: "title", PageSize: 1}, []string{"Live"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.ListBlogPage(tt.ctx, tt.req)
+			if err != nil {
+				t.Fatalf("ListBlogPage() error = %v", err)
+			}
+
+			var got []string
+			for _, blog := range res.GetBlogs() {
+				got = append(got, blog.GetTitle())
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListBlogPage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDraftVisibility(t *testing.T) {
+	client, authors := tenantTestServer(t)
+
+	author, err := authors.CreateAuthor(context.Background(), &blogpb.CreateAuthorRequest{
+		Author: &blogpb.Author{DisplayName: "Author"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAuthor failed: %v", err)
+	}
+	authorID := author.GetAuthor().GetId()
+	authorCtx := metadata.AppendToOutgoingContext(context.Background(), userMetadataKey, authorID)
+
+	draft, err := client.CreateBlog(authorCtx, &blogpb.CreateBlogRequest{
+		Blog: &blogpb.Blog{AuthorId: authorID, Title: "Draft", Content: "Not out yet"},
+	})
+	if err != nil {
+		t.Fatalf("CreateBlog failed: %v", err)
+	}
+	id := draft.GetBlog().GetId()
+
+	_, err = client.CreateComment(authorCtx, &blogpb.CreateCommentRequest{
+		Comment: &blogpb.Comment{BlogId: id, AuthorId: authorID, Content: "Note to self"},
+	})
+	if err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+
+	upload, err := client.UploadAttachment(authorCtx)
+	if err != nil {
+		t.Fatalf("UploadAttachment failed: %v", err)
+	}
+	uploaded, err := uploadAttachment(upload, id)
+	if err != nil {
+		t.Fatalf("UploadAttachment failed: %v", err)
+	}
+
+	rpcs := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"ReadBlog", func(ctx context.Context) error {
+			_, err := client.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: id})
+			return err
+		}},
+		{"BatchGetBlogs", func(ctx context.Context) error {
+			res, err := client.BatchGetBlogs(ctx, &blogpb.BatchGetBlogsRequest{BlogIds: []string{id}})
+			if err != nil {
+				return err
+			}
+
+			return status.ErrorProto(res.GetResults()[0].GetStatus())
+		}},
+		{"RenderBlog", func(ctx context.Context) error {
+			_, err := client.RenderBlog(ctx, &blogpb.RenderBlogRequest{BlogId: id})
+			return err
+		}},
+		{"ListBlogRevisions", func(ctx context.Context) error {
+			_, err := client.ListBlogRevisions(ctx, &blogpb.ListBlogRevisionsRequest{BlogId: id})
+			return err
+		}},
+		{"GetBlogRevision", func(ctx context.Context) error {
+			_, err := client.GetBlogRevision(ctx, &blogpb.GetBlogRevisionRequest{BlogId: id, Revision: 1})
+			return err
+		}},
+		{"ListComments", func(ctx context.Context) error {
+			_, err := client.ListComments(ctx, &blogpb.ListCommentsRequest{BlogId: id})
+			return err
+		}},
+		{"DownloadAttachment", func(ctx context.Context) error {
+			download, err := client.DownloadAttachment(ctx, &blogpb.DownloadAttachmentRequest{
+				BlogId: id, AttachmentId: uploaded.GetAttachment().GetId(),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = download.Recv()
+			return err
+		}},
+	}
+
+	callers := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{"author", authorCtx, codes.OK},
+		{"other user", metadata.AppendToOutgoingContext(context.Background(), userMetadataKey, primitive.NewObjectID().Hex()), codes.NotFound},
+		{"anonymous", context.Background(), codes.NotFound},
+	}
+
+	for _, rpc := range rpcs {
+		t.Run(rpc.name, func(t *testing.T) {
+			for _, caller := range callers {
+				err := rpc.call(caller.ctx)
+				if status.Code(err) != caller.wantCode {
+					t.Errorf("%v of a draft by %v = %v, want %v", rpc.name, caller.name, err, caller.wantCode)
+				}
+			}
+		})
+	}
+
+	_, err = client.PublishBlog(authorCtx, &blogpb.PublishBlogRequest{BlogId: id})
+	if err != nil {
+		t.Fatalf("PublishBlog failed: %v", err)
+	}
+
+	for _, rpc := range rpcs {
+		err := rpc.call(context.Background())
+		if err != nil {
+			t.Errorf("%v of a published blog by anonymous = %v, want %v", rpc.name, err, codes.OK)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// slugIndex is the name of the unique index on the slugs of the mongo
+	// store.
+	slugIndex = "blog_slug"
+	// maxSlugLength is the maximum length of a slug before a collision
+	// suffix is appended.
+	maxSlugLength = 80
+	// slugAttempts is the number of numbered slugs tried on collisions
+	// before falling back to a slug suffixed with the blog id.
+	slugAttempts = 10
+)
+
+// slugify turns a title into the lowercase ascii letters and digits of its
+// words joined by dashes. Accents are dropped, other characters separate
+// words.
+func slugify(title string) string {
+	var b strings.Builder
+
+	dash := false
+
+	for _, r := range norm.NFKD.String(title) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			dash = true
+		}
+
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		return "blog"
+	}
+
+	return slug
+}
+
+// slugBase is the slug a blog gets when it is free. Imported blogs keep their
+// slug, others derive it from their title.
+func slugBase(blog BlogItem) string {
+	if blog.Slug != "" {
+		return slugify(blog.Slug)
+	}
+
+	return slugify(blog.Title)
+}
+
+// slugCandidate is the slug tried for a blog after attempt collisions: base,
+// base-2, base-3 and so on, and finally base with the id appended, which no
+// other blog can collide with.
+func slugCandidate(base string, id primitive.ObjectID, attempt int) string {
+	if attempt == 0 {
+		return base
+	}
+
+	if attempt < slugAttempts {
+		return base + "-" + strconv.Itoa(attempt+1)
+	}
+
+	return base + "-" + id.Hex()
+}
+
+// createBlog stores a new blog under the first free slug candidate.
+func (s *server) createBlog(ctx context.Context, blog BlogItem) (BlogItem, error) {
+	base := slugBase(blog)
+
+	for attempt := 0; ; attempt++ {
+		blog.Slug = slugCandidate(base, blog.ID, attempt)
+
+		created, err := s.store.Create(ctx, blog)
+		if err != errSlugTaken || attempt == slugAttempts {
+			return created, err
+		}
+	}
+}
+
+// createBlogs is createBlog for BlogStore.CreateMany, it sets the slug of
+// every blog in place. Blogs of the batch get distinct slugs, and those whose
+// slug turns out to be taken are created again with their next candidate. An
+// atomic batch is retried as a whole if it only failed on slugs.
+func (s *server) createBlogs(ctx context.Context, blogs []BlogItem, atomic bool) ([]error, error) {
+	bases := make([]string, len(blogs))
+	attempts := make([]int, len(blogs))
+	used := make(map[string]bool)
+
+	nextSlug := func(i int) {
+		for {
+			blogs[i].Slug = slugCandidate(bases[i], blogs[i].ID, attempts[i])
+			attempts[i]++
+
+			if !used[blogs[i].Slug] {
+				used[blogs[i].Slug] = true
+				return
+			}
+		}
+	}
+
+	pending := make([]int, len(blogs))
+	for i := range blogs {
+		bases[i] = slugBase(blogs[i])
+		nextSlug(i)
+		pending[i] = i
+	}
+
+	errs := make([]error, len(blogs))
+
+	for round := 0; ; round++ {
+		batch := make([]BlogItem, len(pending))
+		for j, i := range pending {
+			batch[j] = blogs[i]
+		}
+
+		batchErrs, err := s.store.CreateMany(ctx, batch, atomic)
+
+		var retry []int
+		onlySlugs := true
+
+		for j, i := range pending {
+			errs[i] = batchErrs[j]
+
+			if batchErrs[j] == errSlugTaken && round < slugAttempts {
+				nextSlug(i)
+				retry = append(retry, i)
+			} else if batchErrs[j] != nil {
+				onlySlugs = false
+			}
+		}
+
+		if len(retry) == 0 || (atomic && !onlySlugs) {
+			return errs, err
+		}
+		if err != nil && err != errBatchAborted {
+			return errs, err
+		}
+
+		if !atomic {
+			pending = retry
+		}
+	}
+}
+
+// updateBlog applies update and, when slugTitle is not empty, gives the blog
+// the first free slug candidate derived from it.
+func (s *server) updateBlog(ctx context.Context, id primitive.ObjectID, update BlogUpdate, slugTitle string) (UpdateResult, error) {
+	if slugTitle == "" {
+		return s.store.Update(ctx, id, update)
+	}
+
+	base := slugify(slugTitle)
+	update.Fields = append(update.Fields, "slug")
+
+	for attempt := 0; ; attempt++ {
+		update.Blog.Slug = slugCandidate(base, id, attempt)
+
+		result, err := s.store.Update(ctx, id, update)
+		if err != errSlugTaken || attempt == slugAttempts {
+			return result, err
+		}
+	}
+}
+
+// slugTitle returns the title an UpdateBlog call derives a new slug from, or
+// an empty string if the blog keeps its slug. Blogs created by the call always
+// get one. title is the title set by the call, if setTitle tells it sets one.
+func (s *server) slugTitle(ctx context.Context, id primitive.ObjectID, req *blogpb.UpdateBlogRequest, title string, setTitle bool) (string, error) {
+	if !req.GetRegenerateSlug() && !req.GetAllowMissing() {
+		return "", nil
+	}
+
+	if !setTitle || !req.GetRegenerateSlug() {
+		stored, err := s.store.Get(ctx, id)
+		if err != nil && err != errBlogNotFound {
+			return "", err
+		}
+
+		// an existing blog keeps its slug unless asked to regenerate it,
+		// a missing one is created by the call or makes it fail
+		if err == nil && !req.GetRegenerateSlug() {
+			return "", nil
+		}
+
+		if err == nil && !setTitle {
+			title = stored.Title
+		}
+	}
+
+	// slugify turns an empty title into the fallback slug
+	if title == "" {
+		return "blog", nil
+	}
+
+	return title, nil
+}
+
+func (s *server) GetBlogBySlug(ctx context.Context, req *blogpb.GetBlogBySlugRequest) (*blogpb.GetBlogBySlugResponse, error) {
+	log.Println("Get Blog By Slug Request RPC Call")
+
+	slug := req.GetSlug()
+
+	// slugs are public links, only the author sees a blog before it is
+	// published
+	blog, err := s.store.GetBySlug(ctx, slug)
+	if err == nil && (blog.deleted() || !blog.visibleTo(viewerID(ctx))) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		return nil, storeError(err, "blog", slug)
+	}
+
+	res := &blogpb.GetBlogBySlugResponse{
+		Blog: blogItemToBlogpb(blog),
+	}
+
+	if req.GetIncludeAuthor() {
+		res.Author, err = s.authorSummary(ctx, blog.AuthorID)
+		if err != nil {
+			return nil, storeError(err, "author", blog.AuthorID.Hex())
+		}
+	}
+
+	return res, nil
+}
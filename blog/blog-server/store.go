@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errBlogNotFound         = errors.New("blog not found")
+	errBlogRevisionMismatch = errors.New("blog revision does not match")
+	errBlogExists           = errors.New("blog already exists")
+	errBlogNotDeleted       = errors.New("blog is not deleted")
+	errRevisionNotFound     = errors.New("blog revision not found")
+	errBatchAborted         = errors.New("batch aborted")
+	errSlugTaken            = errors.New("blog slug already taken")
+)
+
+// BlogStore is the persistence layer used by the blog server.
+type BlogStore interface {
+	Create(ctx context.Context, blog BlogItem) (BlogItem, error)
+	// CreateMany stores blogs and returns the error of each of them, nil for
+	// the stored ones. When atomic is set and any blog fails, none is kept and
+	// errBatchAborted is returned along with the errors. Like Create and
+	// Update it fails with errSlugTaken for a slug another blog already has.
+	CreateMany(ctx context.Context, blogs []BlogItem, atomic bool) ([]error, error)
+	// Get returns the blog with the given id, even if it is deleted.
+	Get(ctx context.Context, id primitive.ObjectID) (BlogItem, error)
+	// GetBySlug is Get for the blog with the given slug.
+	GetBySlug(ctx context.Context, slug string) (BlogItem, error)
+	// GetMany returns the blogs among ids that exist, deleted ones included.
+	GetMany(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]BlogItem, error)
+	// Update applies update to the blog with the given id and bumps its
+	// revision. Deleted blogs can not be updated.
+	Update(ctx context.Context, id primitive.ObjectID, update BlogUpdate) (UpdateResult, error)
+	// Delete marks the blog with the given id as deleted at deleteTime and
+	// returns it. When revision is not nil the blog is only deleted if it is
+	// still at that revision.
+	Delete(ctx context.Context, id primitive.ObjectID, revision *int64, deleteTime time.Time) (BlogItem, error)
+	// DeleteMany marks the blogs among ids that exist and are not deleted yet
+	// as deleted at deleteTime and returns them. When atomic is set and any of
+	// the blogs can not be deleted, none is and errBlogNotFound is returned.
+	DeleteMany(ctx context.Context, ids []primitive.ObjectID, deleteTime time.Time, atomic bool) (map[primitive.ObjectID]BlogItem, error)
+	// Undelete restores a deleted blog.
+	Undelete(ctx context.Context, id primitive.ObjectID) (BlogItem, error)
+	// ListPurgeable returns the ids of the blogs deleted before deletedBefore.
+	ListPurgeable(ctx context.Context, deletedBefore time.Time) ([]primitive.ObjectID, error)
+	// Purge permanently removes the blogs with the given ids that are still
+	// deleted before deletedBefore along with their revisions and returns the
+	// ids of the removed blogs.
+	Purge(ctx context.Context, ids []primitive.ObjectID, deletedBefore time.Time) ([]primitive.ObjectID, error)
+	// List calls fn for every blog matching query in the order it asks for and
+	// stops at the first error.
+	List(ctx context.Context, query ListQuery, fn func(BlogItem) error) error
+	// Search returns at most limit blogs visible to viewer whose title or
+	// content contains any word of query, most relevant first. Deleted blogs
+	// are never returned.
+	Search(ctx context.Context, query string, viewer primitive.ObjectID, limit int64) ([]SearchHit, error)
+	// ListScheduled returns the scheduled blogs that are not deleted and due
+	// to be published at until.
+	ListScheduled(ctx context.Context, until time.Time) ([]BlogItem, error)
+	// ListTags counts the blogs visible to viewer that are not deleted per tag
+	// and returns at most limit counts, most used tag first. A limit of zero
+	// returns all.
+	ListTags(ctx context.Context, viewer primitive.ObjectID, limit int64) ([]TagCount, error)
+	// Watch calls fn for every change to a blog visible to viewer after the
+	// event the resume token belongs to, or from now on without one, until
+	// ctx is done or fn fails. Restoring a deleted blog is reported as
+	// EventCreated.
+	Watch(ctx context.Context, resumeToken string, viewer primitive.ObjectID, fn func(BlogEvent) error) error
+
+	// AddRevision appends a revision to the history of a blog.
+	AddRevision(ctx context.Context, revision BlogRevisionItem) error
+	GetRevision(ctx context.Context, blogID primitive.ObjectID, revision int64) (BlogRevisionItem, error)
+	// ListRevisions returns at most limit revisions of a blog older than
+	// before, newest first. A before of zero starts at the newest revision.
+	ListRevisions(ctx context.Context, blogID primitive.ObjectID, before int64, limit int64) ([]BlogRevisionItem, error)
+}
+
+// BlogUpdate describes a change to a stored blog.
+type BlogUpdate struct {
+	Blog BlogItem
+	// Fields lists the fields, named as in blogFields, copied from Blog.
+	Fields []string
+	// Revision, when not nil, makes the update fail with
+	// errBlogRevisionMismatch unless the blog is still at this revision.
+	Revision *int64
+	// AllowMissing creates the blog instead of failing with errBlogNotFound
+	// when it does not exist. A created blog gets Blog.UpdateTime as its
+	// creation time. It has no effect together with Revision and fails with
+	// errBlogExists if the blog exists but is deleted.
+	AllowMissing bool
+}
+
+// UpdateResult is the outcome of BlogStore.Update.
+type UpdateResult struct {
+	// Before is the blog as it was before the update, the zero BlogItem if
+	// it got created.
+	Before  BlogItem
+	Blog    BlogItem
+	Created bool
+}
+
+// applyUpdate returns the blog resulting from applying update to before, or
+// to a new blog with the given id if created is set.
+func applyUpdate(id primitive.ObjectID, before BlogItem, created bool, update BlogUpdate) BlogItem {
+	blog := before
+	if created {
+		blog = BlogItem{ID: id, CreateTime: update.Blog.UpdateTime, State: StateDraft}
+	}
+
+	for _, field := range update.Fields {
+		blogFields[field].set(&blog, update.Blog)
+	}
+	blog.Revision++
+
+	return blog
+}
+
+// ListQuery narrows down the blogs returned by BlogStore.List.
+type ListQuery struct {
+	// AuthorID only matches blogs of this author when set.
+	AuthorID primitive.ObjectID
+	// TitlePrefix only matches blogs whose title starts with it when set.
+	TitlePrefix string
+	// Tags only matches blogs with any of these tags when set, or with all
+	// of them if MatchAllTags is set.
+	Tags         []string
+	MatchAllTags bool
+	// CreatedAfter and CreatedBefore only match blogs created strictly
+	// after, respectively before, them when set.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Deleted       DeletedFilter
+	// PublishedOnly hides the blogs that are not visible to Viewer, see
+	// BlogItem.visibleTo.
+	PublishedOnly bool
+	Viewer        primitive.ObjectID
+	Order         Ordering
+	// After skips every blog up to and including the cursor when set.
+	After *Cursor
+	// Limit caps the number of blogs returned, zero means no limit.
+	Limit int64
+}
+
+// DeletedFilter selects blogs by whether they are deleted.
+type DeletedFilter int
+
+const (
+	HideDeleted DeletedFilter = iota
+	ShowDeleted
+	OnlyDeleted
+)
+
+// Cursor is a position in a list ordered by some Ordering: the sort key and
+// the id of the last blog seen.
+type Cursor struct {
+	Key interface{}        `bson:"k"`
+	ID  primitive.ObjectID `bson:"id"`
+}
+
+type BlogItem struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	AuthorID   primitive.ObjectID `bson:"authorId,omitempty"`
+	Content    string             `bson:"content,omitempty"`
+	Title      string             `bson:"title,omitempty"`
+	CreateTime time.Time          `bson:"createTime,omitempty"`
+	UpdateTime time.Time          `bson:"updateTime,omitempty"`
+	// Revision starts at 1 and is incremented by every update.
+	Revision   int64     `bson:"revision"`
+	DeleteTime time.Time `bson:"deleteTime,omitempty"`
+	// Tags are normalized by normalizeTags.
+	Tags []string `bson:"tags,omitempty"`
+	// State is empty for blogs stored before blogs had states, which count
+	// as published.
+	State       BlogState `bson:"state,omitempty"`
+	PublishTime time.Time `bson:"publishTime,omitempty"`
+	// ContentFormat is empty for blogs stored before blogs had formats, which
+	// are plain text.
+	ContentFormat ContentFormat `bson:"contentFormat,omitempty"`
+	// Slug is unique among all blogs, deleted ones included. It is empty for
+	// blogs stored before blogs had slugs.
+	Slug string `bson:"slug,omitempty"`
+	// Attachments describe the content kept in the AttachmentStore.
+	Attachments []AttachmentItem `bson:"attachments,omitempty"`
+}
+
+func (b BlogItem) deleted() bool {
+	return !b.DeleteTime.IsZero()
+}
+
+// visibleTo reports whether viewer may see the blog: published blogs are
+// visible to anyone, others only to their author. A zero viewer is anonymous.
+func (b BlogItem) visibleTo(viewer primitive.ObjectID) bool {
+	return b.state() == StatePublished || (!viewer.IsZero() && b.AuthorID == viewer)
+}
+
+func (b BlogItem) state() BlogState {
+	if b.State == "" {
+		return StatePublished
+	}
+
+	return b.State
+}
+
+func (b BlogItem) contentFormat() ContentFormat {
+	if b.ContentFormat == "" {
+		return ContentPlain
+	}
+
+	return b.ContentFormat
+}
+
+// BlogState is the stage of the publishing workflow a blog is in.
+type BlogState string
+
+const (
+	StateDraft     BlogState = "draft"
+	StateScheduled BlogState = "scheduled"
+	StatePublished BlogState = "published"
+	StateArchived  BlogState = "archived"
+)
+
+// ContentFormat is the markup the content of a blog is written in.
+type ContentFormat string
+
+const (
+	ContentPlain    ContentFormat = "plain"
+	ContentMarkdown ContentFormat = "markdown"
+	ContentHTML     ContentFormat = "html"
+)
+
+// blogFields describes the fields of a blog an update can overwrite, keyed by
+// their proto field name.
+var blogFields = map[string]blogField{
+	"author_id": {
+		key: "authorId",
+		get: func(b BlogItem) interface{} { return b.AuthorID },
+		set: func(dst *BlogItem, src BlogItem) { dst.AuthorID = src.AuthorID },
+	},
+	"title": {
+		key: "title",
+		get: func(b BlogItem) interface{} { return b.Title },
+		set: func(dst *BlogItem, src BlogItem) { dst.Title = src.Title },
+	},
+	"content": {
+		key: "content",
+		get: func(b BlogItem) interface{} { return b.Content },
+		set: func(dst *BlogItem, src BlogItem) { dst.Content = src.Content },
+	},
+	"content_format": {
+		key: "contentFormat",
+		get: func(b BlogItem) interface{} { return b.ContentFormat },
+		set: func(dst *BlogItem, src BlogItem) { dst.ContentFormat = src.ContentFormat },
+	},
+	"tags": {
+		key: "tags",
+		get: func(b BlogItem) interface{} { return b.Tags },
+		set: func(dst *BlogItem, src BlogItem) { dst.Tags = src.Tags },
+	},
+	"state": {
+		key: "state",
+		get: func(b BlogItem) interface{} { return b.State },
+		set: func(dst *BlogItem, src BlogItem) { dst.State = src.State },
+	},
+	"publish_time": {
+		key: "publishTime",
+		get: func(b BlogItem) interface{} { return b.PublishTime },
+		set: func(dst *BlogItem, src BlogItem) { dst.PublishTime = src.PublishTime },
+	},
+	"slug": {
+		key: "slug",
+		get: func(b BlogItem) interface{} { return b.Slug },
+		set: func(dst *BlogItem, src BlogItem) { dst.Slug = src.Slug },
+	},
+	"attachments": {
+		key: "attachments",
+		get: func(b BlogItem) interface{} { return b.Attachments },
+		set: func(dst *BlogItem, src BlogItem) { dst.Attachments = src.Attachments },
+	},
+	"update_time": {
+		key: "updateTime",
+		get: func(b BlogItem) interface{} { return b.UpdateTime },
+		set: func(dst *BlogItem, src BlogItem) { dst.UpdateTime = src.UpdateTime },
+	},
+}
+
+type blogField struct {
+	key string
+	get func(BlogItem) interface{}
+	set func(dst *BlogItem, src BlogItem)
+}
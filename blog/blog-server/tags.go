@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+)
+
+const (
+	maxTagsPerBlog = 20
+	maxTagLength   = 50
+)
+
+// TagCount is the number of blogs that are not deleted with a tag.
+type TagCount struct {
+	Tag   string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// normalizeTags lowercases tags, trims the whitespace around them and drops
+// empty and duplicate ones, keeping the order they were first given in.
+// Violations are reported for field.
+func normalizeTags(field string, tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, invalidField(field, "tag %q is longer than %v characters", tag, maxTagLength)
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxTagsPerBlog {
+		return nil, invalidField(field, "a blog can have at most %v tags, got %v", maxTagsPerBlog, len(normalized))
+	}
+
+	return normalized, nil
+}
+
+// sortTagCounts orders counts by descending count and then by tag and cuts
+// them down to limit, zero meaning no limit.
+func sortTagCounts(counts []TagCount, limit int64) []TagCount {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+
+		return counts[i].Tag < counts[j].Tag
+	})
+
+	if limit > 0 && int64(len(counts)) > limit {
+		counts = counts[:limit]
+	}
+
+	return counts
+}
+
+func (s *server) ListTags(ctx context.Context, req *blogpb.ListTagsRequest) (*blogpb.ListTagsResponse, error) {
+	log.Println("List Tags Request RPC Call")
+
+	limit := req.GetLimit()
+	if limit < 0 {
+		return nil, invalidField("limit", "limit must not be negative: %v", limit)
+	}
+
+	counts, err := s.store.ListTags(ctx, viewerID(ctx), int64(limit))
+	if err != nil {
+		return nil, storeError(err, "blog", "")
+	}
+
+	res := &blogpb.ListTagsResponse{}
+	for _, count := range counts {
+		res.Tags = append(res.Tags, &blogpb.TagCount{
+			Tag:   count.Tag,
+			Count: count.Count,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// tenantMetadataKey is the request metadata naming the publication a call
+	// is made for.
+	tenantMetadataKey = "x-tenant-id"
+	// defaultTenant is the tenant of calls without tenant metadata. It owns
+	// the data written before there were tenants.
+	defaultTenant = "default"
+)
+
+// tenantPattern is what tenant ids look like. They end up in database and
+// directory names, so they are kept short and plain.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// tenantDatabase is the name of the mongo database holding the data of
+// tenant. The default tenant uses database, the others get a database of
+// their own with the tenant appended to its name.
+func tenantDatabase(database, tenant string) string {
+	if tenant == defaultTenant {
+		return database
+	}
+
+	return database + "-" + tenant
+}
+
+type tenantKey struct{}
+
+// withTenant returns a copy of ctx whose calls to the stores are routed to
+// tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFromContext returns the tenant set by withTenant, or the default
+// tenant.
+func tenantFromContext(ctx context.Context) string {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	if !ok {
+		return defaultTenant
+	}
+
+	return tenant
+}
+
+// tenantStores are the stores holding the data of a single tenant.
+type tenantStores struct {
+	blogs       BlogStore
+	comments    CommentStore
+	authors     AuthorStore
+	attachments AttachmentStore
+}
+
+// tenantRegistry opens the stores of a tenant on its first call and keeps
+// them for the ones after.
+type tenantRegistry struct {
+	open    func(ctx context.Context, tenant string) (*tenantStores, error)
+	allowed map[string]bool
+	// timeout bounds opening the stores of a tenant.
+	timeout time.Duration
+
+	mu     sync.Mutex
+	stores map[string]*openedTenant
+	known  map[string]bool
+}
+
+// openedTenant holds the stores of a tenant once done is closed. Opening may
+// migrate a database, so it happens outside of the lock of the registry and
+// the calls for the tenant wait for it.
+type openedTenant struct {
+	done   chan struct{}
+	stores *tenantStores
+	err    error
+}
+
+// newTenantRegistry returns a registry opening stores with open, taking at
+// most timeout each. Calls may only be made for the default tenant, the
+// allowed tenants and the tenants added for their existing data, so a call
+// can not create a tenant that is not configured.
+func newTenantRegistry(open func(ctx context.Context, tenant string) (*tenantStores, error), allowed []string, timeout time.Duration) *tenantRegistry {
+	r := &tenantRegistry{
+		open:    open,
+		allowed: map[string]bool{defaultTenant: true},
+		timeout: timeout,
+		stores:  make(map[string]*openedTenant),
+		known:   map[string]bool{defaultTenant: true},
+	}
+
+	for _, tenant := range allowed {
+		r.allowed[tenant] = true
+	}
+
+	return r
+}
+
+// add makes a tenant with existing data known, so background jobs visit it
+// before it is called for and calls may be made for it.
+func (r *tenantRegistry) add(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.known[tenant] = true
+}
+
+// tenants returns the known tenants in order.
+func (r *tenantRegistry) tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := make([]string, 0, len(r.known))
+	for tenant := range r.known {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	return tenants
+}
+
+// get returns the stores of the tenant of ctx.
+func (r *tenantRegistry) get(ctx context.Context) (*tenantStores, error) {
+	tenant := tenantFromContext(ctx)
+
+	r.mu.Lock()
+	opened, ok := r.stores[tenant]
+	if !ok {
+		opened = &openedTenant{done: make(chan struct{})}
+		r.stores[tenant] = opened
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		go r.openTenant(tenant, opened)
+	}
+
+	select {
+	case <-opened.done:
+		return opened.stores, opened.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// openTenant opens the stores of tenant into opened. When that fails the
+// calls waiting for it get the error and the next call tries again. It does
+// not use the context of a call, a call giving up must not leave a migration
+// half applied or fail the other calls waiting for the tenant.
+func (r *tenantRegistry) openTenant(tenant string, opened *openedTenant) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	opened.stores, opened.err = r.open(ctx, tenant)
+
+	r.mu.Lock()
+	if opened.err != nil {
+		delete(r.stores, tenant)
+	} else {
+		r.known[tenant] = true
+	}
+	r.mu.Unlock()
+
+	close(opened.done)
+}
+
+// allowedTenant reports whether calls may be made for tenant.
+func (r *tenantRegistry) allowedTenant(tenant string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.allowed[tenant] || r.known[tenant]
+}
+
+// tenant returns the tenant named by the metadata of an incoming call.
+func (r *tenantRegistry) tenant(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get(tenantMetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return defaultTenant, nil
+	}
+	if len(values) > 1 {
+		return "", errorWithInfo(codes.InvalidArgument, "INVALID_TENANT", "tenant", "", "only one %v may be given", tenantMetadataKey)
+	}
+
+	tenant := values[0]
+
+	if !tenantPattern.MatchString(tenant) {
+		return "", errorWithInfo(codes.InvalidArgument, "INVALID_TENANT", "tenant", tenant, "invalid tenant: %q", tenant)
+	}
+
+	if !r.allowedTenant(tenant) {
+		return "", errorWithInfo(codes.PermissionDenied, "TENANT_NOT_ALLOWED", "tenant", tenant, "unknown tenant: %v", tenant)
+	}
+
+	return tenant, nil
+}
+
+// unaryInterceptor routes every call to the stores of the tenant named by its
+// metadata. Whatever the handler does with the stores stays within it.
+func (r *tenantRegistry) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	tenant, err := r.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(withTenant(ctx, tenant), req)
+}
+
+// streamInterceptor does the same for streams.
+func (r *tenantRegistry) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	tenant, err := r.tenant(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &tenantServerStream{ServerStream: ss, ctx: withTenant(ss.Context(), tenant)})
+}
+
+type tenantServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// forEachTenant calls fn with a context for each known tenant, or once with
+// ctx when the server is not split into tenants.
+func (s *server) forEachTenant(ctx context.Context, fn func(ctx context.Context)) {
+	if s.tenants == nil {
+		fn(ctx)
+		return
+	}
+
+	for _, tenant := range s.tenants.tenants() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		fn(withTenant(ctx, tenant))
+	}
+}
+
+// openMongoTenant opens the stores of a tenant in its database. With
+// autoMigrate set the pending migrations of the database are applied first,
+// otherwise a database with pending migrations is refused.
+func openMongoTenant(client *mongo.Client, database string, autoMigrate bool) func(ctx context.Context, tenant string) (*tenantStores, error) {
+	return func(ctx context.Context, tenant string) (*tenantStores, error) {
+		db := client.Database(tenantDatabase(database, tenant))
+
+		if autoMigrate {
+			err := migrate(ctx, db, false)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			pending, err := pendingMigrations(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+			if len(pending) > 0 {
+				return nil, fmt.Errorf("database %v has %v pending migrations, run blog-server migrate", db.Name(), len(pending))
+			}
+		}
+
+		err := registerMongoTenant(ctx, client, database, tenant)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tenantStores{
+			blogs:       newMongoStore(db),
+			comments:    newMongoCommentStore(db),
+			authors:     newMongoAuthorStore(db),
+			attachments: newMongoAttachmentStore(db),
+		}, nil
+	}
+}
+
+// tenantsCollection records, in the database of the default tenant, the
+// tenants the server created or migrated a database for.
+const tenantsCollection = "tenants"
+
+type registeredTenant struct {
+	ID           string    `bson:"_id"`
+	RegisterTime time.Time `bson:"registerTime"`
+}
+
+// registerMongoTenant records that tenant has a database of its own. Only
+// the server registers tenants, so other databases whose names happen to
+// look like the one of a tenant are never served.
+func registerMongoTenant(ctx context.Context, client *mongo.Client, database, tenant string) error {
+	if tenant == defaultTenant {
+		return nil
+	}
+
+	_, err := client.Database(database).Collection(tenantsCollection).InsertOne(ctx, registeredTenant{
+		ID:           tenant,
+		RegisterTime: timeNow(),
+	})
+	// registered before
+	if mongo.IsDuplicateKeyError(err) {
+		err = nil
+	}
+
+	return err
+}
+
+// mongoTenants returns the registered tenants, see registerMongoTenant.
+func mongoTenants(ctx context.Context, client *mongo.Client, database string) ([]string, error) {
+	cursor, err := client.Database(database).Collection(tenantsCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var registered []registeredTenant
+
+	err = cursor.All(ctx, &registered)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []string
+
+	for _, tenant := range registered {
+		if tenantPattern.MatchString(tenant.ID) && tenant.ID != defaultTenant {
+			tenants = append(tenants, tenant.ID)
+		}
+	}
+
+	return tenants, nil
+}
+
+// openMemoryTenant opens empty in-memory stores for a tenant, keeping its
+// attachments in a directory of its own below dir.
+func openMemoryTenant(dir string) func(ctx context.Context, tenant string) (*tenantStores, error) {
+	return func(ctx context.Context, tenant string) (*tenantStores, error) {
+		attachments, err := newDiskAttachmentStore(filepath.Join(dir, tenant))
+		if err != nil {
+			return nil, err
+		}
+
+		return &tenantStores{
+			blogs:       newMemoryStore(),
+			comments:    newMemoryCommentStore(),
+			authors:     newMemoryAuthorStore(),
+			attachments: attachments,
+		}, nil
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// pngHeader is enough of a PNG image for http.DetectContentType.
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// tenantTestServer serves the blog and author services over an in-memory
+// connection, wired like main does with the in-memory stores, and returns
+// clients for them.
+func tenantTestServer(t *testing.T, tenants ...string) (blogpb.BlogServiceClient, blogpb.AuthorServiceClient) {
+	t.Helper()
+
+	registry := newTenantRegistry(openMemoryTenant(t.TempDir()), tenants, time.Minute)
+	srv := &server{
+		store:       tenantBlogStore{registry},
+		comments:    tenantCommentStore{registry},
+		authors:     tenantAuthorStore{registry},
+		attachments: tenantAttachmentStore{registry},
+		tenants:     registry,
+	}
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(registry.unaryInterceptor, validationUnaryInterceptor),
+		grpc.ChainStreamInterceptor(registry.streamInterceptor, validationStreamInterceptor),
+	)
+	blogpb.RegisterBlogServiceServer(s, srv)
+	blogpb.RegisterAuthorServiceServer(s, &authorServer{authors: srv.authors})
+
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return blogpb.NewBlogServiceClient(conn), blogpb.NewAuthorServiceClient(conn)
+}
+
+// tenantData is what a test creates in a tenant.
+type tenantData struct {
+	ctx        context.Context
+	authorID   string
+	blog       *blogpb.Blog
+	comment    *blogpb.Comment
+	attachment *blogpb.Attachment
+}
+
+// newTenantData creates an author and a published blog with a comment and an
+// attachment in tenant, calling as the author.
+func newTenantData(t *testing.T, client blogpb.BlogServiceClient, authors blogpb.AuthorServiceClient, tenant string) tenantData {
+	t.Helper()
+
+	d := tenantData{ctx: metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, tenant)}
+
+	author, err := authors.CreateAuthor(d.ctx, &blogpb.CreateAuthorRequest{
+		Author: &blogpb.Author{DisplayName: "Author of " + tenant},
+	})
+	if err != nil {
+		t.Fatalf("CreateAuthor in %v failed: %v", tenant, err)
+	}
+	d.authorID = author.GetAuthor().GetId()
+	d.ctx = metadata.AppendToOutgoingContext(d.ctx, userMetadataKey, d.authorID)
+
+	created, err := client.CreateBlog(d.ctx, &blogpb.CreateBlogRequest{
+		Blog: &blogpb.Blog{
+			AuthorId: d.authorID,
+			Title:    "Tenant news " + tenant,
+			Content:  "Shared words",
+			Tags:     []string{"tenant-" + tenant},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateBlog in %v failed: %v", tenant, err)
+	}
+
+	published, err := client.PublishBlog(d.ctx, &blogpb.PublishBlogRequest{BlogId: created.GetBlog().GetId()})
+	if err != nil {
+		t.Fatalf("PublishBlog in %v failed: %v", tenant, err)
+	}
+	d.blog = published.GetBlog()
+
+	comment, err := client.CreateComment(d.ctx, &blogpb.CreateCommentRequest{
+		Comment: &blogpb.Comment{BlogId: d.blog.GetId(), AuthorId: d.authorID, Content: "First"},
+	})
+	if err != nil {
+		t.Fatalf("CreateComment in %v failed: %v", tenant, err)
+	}
+	d.comment = comment.GetComment()
+
+	upload, err := client.UploadAttachment(d.ctx)
+	if err != nil {
+		t.Fatalf("UploadAttachment in %v failed: %v", tenant, err)
+	}
+	uploaded, err := uploadAttachment(upload, d.blog.GetId())
+	if err != nil {
+		t.Fatalf("UploadAttachment in %v failed: %v", tenant, err)
+	}
+	d.blog = uploaded.GetBlog()
+	d.attachment = uploaded.GetAttachment()
+
+	return d
+}
+
+func uploadAttachment(upload blogpb.BlogService_UploadAttachmentClient, blogId string) (*blogpb.UploadAttachmentResponse, error) {
+	err := upload.Send(&blogpb.UploadAttachmentRequest{Data: &blogpb.UploadAttachmentRequest_Metadata{
+		Metadata: &blogpb.AttachmentMetadata{BlogId: blogId, Filename: "image.png", ContentType: "image/png"},
+	}})
+	if err == nil {
+		err = upload.Send(&blogpb.UploadAttachmentRequest{Data: &blogpb.UploadAttachmentRequest_Chunk{
+			Chunk: []byte(pngHeader),
+		}})
+	}
+	// a failed send is reported by CloseAndRecv
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return upload.CloseAndRecv()
+}
+
+func TestTenantIsolation(t *testing.T) {
+	client, authors := tenantTestServer(t, "a", "b")
+
+	a := newTenantData(t, client, authors, "a")
+	b := newTenantData(t, client, authors, "b")
+
+	for _, tc := range []struct {
+		name        string
+		own, others tenantData
+	}{
+		{"a", a, b},
+		{"b", b, a},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// every call is made for the data of the other tenant, as its
+			// author
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, tc.name, userMetadataKey, tc.others.authorID)
+			other := tc.others.blog.GetId()
+
+			notFound := []struct {
+				name string
+				call func() error
+			}{
+				{"ReadBlog", func() error {
+					_, err := client.ReadBlog(ctx, &blogpb.ReadBlogRequest{BlogId: other, ShowDeleted: true})
+					return err
+				}},
+				{"GetBlogBySlug", func() error {
+					_, err := client.GetBlogBySlug(ctx, &blogpb.GetBlogBySlugRequest{Slug: tc.others.blog.GetSlug()})
+					return err
+				}},
+				{"UpdateBlog", func() error {
+					_, err := client.UpdateBlog(ctx, &blogpb.UpdateBlogRequest{Blog: &blogpb.Blog{Id: other, Title: "Taken over"}})
+					return err
+				}},
+				{"DeleteBlog", func() error {
+					_, err := client.DeleteBlog(ctx, &blogpb.DeleteBlogRequest{BlogId: other})
+					return err
+				}},
+				{"UnpublishBlog", func() error {
+					_, err := client.UnpublishBlog(ctx, &blogpb.UnpublishBlogRequest{BlogId: other})
+					return err
+				}},
+				{"RenderBlog", func() error {
+					_, err := client.RenderBlog(ctx, &blogpb.RenderBlogRequest{BlogId: other})
+					return err
+				}},
+				{"ListBlogRevisions", func() error {
+					_, err := client.ListBlogRevisions(ctx, &blogpb.ListBlogRevisionsRequest{BlogId: other})
+					return err
+				}},
+				{"GetBlogRevision", func() error {
+					_, err := client.GetBlogRevision(ctx, &blogpb.GetBlogRevisionRequest{BlogId: other, Revision: 1})
+					return err
+				}},
+				{"CreateComment", func() error {
+					_, err := client.CreateComment(ctx, &blogpb.CreateCommentRequest{Comment: &blogpb.Comment{
+						BlogId: other, AuthorId: tc.own.authorID, Content: "Hello",
+					}})
+					return err
+				}},
+				{"ListComments", func() error {
+					_, err := client.ListComments(ctx, &blogpb.ListCommentsRequest{BlogId: other})
+					return err
+				}},
+				{"UpdateComment", func() error {
+					_, err := client.UpdateComment(ctx, &blogpb.UpdateCommentRequest{Comment: &blogpb.Comment{
+						Id: tc.others.comment.GetId(), BlogId: other, Content: "Changed",
+					}})
+					return err
+				}},
+				{"DeleteComment", func() error {
+					_, err := client.DeleteComment(ctx, &blogpb.DeleteCommentRequest{BlogId: other, CommentId: tc.others.comment.GetId()})
+					return err
+				}},
+				{"UploadAttachment", func() error {
+					upload, err := client.UploadAttachment(ctx)
+					if err != nil {
+						return err
+					}
+
+					_, err = uploadAttachment(upload, other)
+					return err
+				}},
+				{"DownloadAttachment", func() error {
+					download, err := client.DownloadAttachment(ctx, &blogpb.DownloadAttachmentRequest{
+						BlogId: other, AttachmentId: tc.others.attachment.GetId(),
+					})
+					if err != nil {
+						return err
+					}
+
+					_, err = download.Recv()
+					return err
+				}},
+			}
+
+			for _, call := range notFound {
+				err := call.call()
+				if status.Code(err) != codes.NotFound {
+					t.Errorf("%v of the blog of the other tenant = %v, want %v", call.name, err, codes.NotFound)
+				}
+			}
+
+			batchGet, err := client.BatchGetBlogs(ctx, &blogpb.BatchGetBlogsRequest{BlogIds: []string{other}, ShowDeleted: true})
+			if err != nil {
+				t.Fatalf("BatchGetBlogs failed: %v", err)
+			}
+			if code := codes.Code(batchGet.GetResults()[0].GetStatus().GetCode()); code != codes.NotFound {
+				t.Errorf("BatchGetBlogs of the blog of the other tenant = %v, want %v", code, codes.NotFound)
+			}
+
+			batchDelete, err := client.BatchDeleteBlogs(ctx, &blogpb.BatchDeleteBlogsRequest{BlogIds: []string{other}})
+			if err != nil {
+				t.Fatalf("BatchDeleteBlogs failed: %v", err)
+			}
+			if code := codes.Code(batchDelete.GetResults()[0].GetStatus().GetCode()); code != codes.NotFound {
+				t.Errorf("BatchDeleteBlogs of the blog of the other tenant = %v, want %v", code, codes.NotFound)
+			}
+
+			// what is listed is the data of the tenant only
+			own := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, tc.name, userMetadataKey, tc.own.authorID)
+
+			page, err := client.ListBlogPage(own, &blogpb.ListBlogRequest{ShowDeleted: true})
+			if err != nil {
+				t.Fatalf("ListBlogPage failed: %v", err)
+			}
+			if len(page.GetBlogs()) != 1 || page.GetBlogs()[0].GetId() != tc.own.blog.GetId() {
+				t.Errorf("ListBlogPage = %v, want only %v", page.GetBlogs(), tc.own.blog.GetId())
+			}
+
+			search, err := client.SearchBlogs(own, &blogpb.SearchBlogsRequest{Query: "shared words"})
+			if err != nil {
+				t.Fatalf("SearchBlogs failed: %v", err)
+			}
+			if len(search.GetResults()) != 1 || search.GetResults()[0].GetBlog().GetId() != tc.own.blog.GetId() {
+				t.Errorf("SearchBlogs = %v, want only %v", search.GetResults(), tc.own.blog.GetId())
+			}
+
+			tags, err := client.ListTags(own, &blogpb.ListTagsRequest{})
+			if err != nil {
+				t.Fatalf("ListTags failed: %v", err)
+			}
+			if len(tags.GetTags()) != 1 || tags.GetTags()[0].GetTag() != "tenant-"+tc.name {
+				t.Errorf("ListTags = %v, want only tenant-%v", tags.GetTags(), tc.name)
+			}
+
+			// the blog of the other tenant is untouched
+			read, err := client.ReadBlog(tc.others.ctx, &blogpb.ReadBlogRequest{BlogId: other})
+			if err != nil {
+				t.Fatalf("ReadBlog in the other tenant failed: %v", err)
+			}
+			if read.GetBlog().GetEtag() != tc.others.blog.GetEtag() {
+				t.Errorf("the blog of the other tenant changed from etag %v to %v", tc.others.blog.GetEtag(), read.GetBlog().GetEtag())
+			}
+
+			comments, err := client.ListComments(tc.others.ctx, &blogpb.ListCommentsRequest{BlogId: other})
+			if err != nil {
+				t.Fatalf("ListComments in the other tenant failed: %v", err)
+			}
+			if len(comments.GetComments()) != 1 || comments.GetComments()[0].GetContent() != tc.others.comment.GetContent() {
+				t.Errorf("the comments of the other tenant changed to %v", comments.GetComments())
+			}
+		})
+	}
+}
+
+func TestTenantIsolationBatchCreateAndWatch(t *testing.T) {
+	client, authors := tenantTestServer(t, "a", "b")
+
+	a := newTenantData(t, client, authors, "a")
+	b := newTenantData(t, client, authors, "b")
+
+	created, err := client.BatchCreateBlogs(a.ctx, &blogpb.BatchCreateBlogsRequest{Blogs: []*blogpb.Blog{
+		{AuthorId: a.authorID, Title: "Batch of a"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateBlogs in a failed: %v", err)
+	}
+
+	// the author of a does not exist in b
+	failed, err := client.BatchCreateBlogs(b.ctx, &blogpb.BatchCreateBlogsRequest{Blogs: []*blogpb.Blog{
+		{AuthorId: a.authorID, Title: "Author of a in b"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateBlogs in b failed: %v", err)
+	}
+	if code := codes.Code(failed.GetResults()[0].GetStatus().GetCode()); code != codes.FailedPrecondition {
+		t.Errorf("BatchCreateBlogs with the author of the other tenant = %v, want %v", code, codes.FailedPrecondition)
+	}
+
+	_, err = client.BatchCreateBlogs(b.ctx, &blogpb.BatchCreateBlogsRequest{Blogs: []*blogpb.Blog{
+		{AuthorId: b.authorID, Title: "Batch of b"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreateBlogs in b failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+
+	// from the first event of the tenant on
+	watch, err := client.WatchBlogs(ctx, &blogpb.WatchBlogsRequest{ResumeToken: encodeSeqToken(0)})
+	if err != nil {
+		t.Fatalf("WatchBlogs failed: %v", err)
+	}
+
+	for {
+		event, err := watch.Recv()
+		if err != nil {
+			t.Fatalf("WatchBlogs failed: %v", err)
+		}
+
+		if event.GetBlog().GetAuthorId() != b.authorID {
+			t.Errorf("watched a change in b to %q of the author %v", event.GetBlog().GetTitle(), event.GetBlog().GetAuthorId())
+		}
+		if event.GetBlog().GetTitle() == "Batch of b" {
+			break
+		}
+	}
+
+	got, err := client.BatchGetBlogs(b.ctx, &blogpb.BatchGetBlogsRequest{BlogIds: []string{created.GetResults()[0].GetBlog().GetId()}})
+	if err != nil {
+		t.Fatalf("BatchGetBlogs failed: %v", err)
+	}
+	if code := codes.Code(got.GetResults()[0].GetStatus().GetCode()); code != codes.NotFound {
+		t.Errorf("BatchGetBlogs in b of a blog created in a = %v, want %v", code, codes.NotFound)
+	}
+}
+
+func TestTenantNotAllowed(t *testing.T) {
+	client, _ := tenantTestServer(t, "a")
+
+	tests := []struct {
+		name   string
+		tenant string
+		want   codes.Code
+	}{
+		{"listed", "a", codes.OK},
+		{"default", defaultTenant, codes.OK},
+		{"not listed", "c", codes.PermissionDenied},
+		{"invalid", "Not a tenant", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, tt.tenant)
+
+			_, err := client.ListTags(ctx, &blogpb.ListTagsRequest{})
+			if status.Code(err) != tt.want {
+				t.Errorf("ListTags in %q = %v, want %v", tt.tenant, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantRegistryOpensOutsideTheLock(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	opens := make(map[string]int)
+
+	registry := newTenantRegistry(func(ctx context.Context, tenant string) (*tenantStores, error) {
+		mu.Lock()
+		opens[tenant]++
+		mu.Unlock()
+
+		if tenant == "slow" {
+			close(started)
+			<-release
+		}
+
+		return &tenantStores{blogs: newMemoryStore()}, nil
+	}, []string{"slow", "fast"}, time.Minute)
+
+	slow := make(chan *tenantStores, 2)
+	getSlow := func() {
+		stores, err := registry.get(withTenant(context.Background(), "slow"))
+		if err != nil {
+			t.Errorf("get of slow failed: %v", err)
+		}
+		slow <- stores
+	}
+
+	go getSlow()
+	<-started
+	go getSlow()
+
+	// another tenant is opened while slow is still being opened
+	fast := make(chan error, 1)
+	go func() {
+		_, err := registry.get(withTenant(context.Background(), "fast"))
+		fast <- err
+	}()
+
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatalf("get of fast failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("get of fast waited for slow to be opened")
+	}
+
+	close(release)
+
+	first, second := <-slow, <-slow
+	if first == nil || first != second {
+		t.Errorf("the calls for slow got the stores %p and %p, want the same ones", first, second)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if opens["slow"] != 1 {
+		t.Errorf("slow opened %v times, want 1", opens["slow"])
+	}
+}
+
+func TestTenantRegistryOpensWithoutTheCallContext(t *testing.T) {
+	opening := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	registry := newTenantRegistry(func(ctx context.Context, tenant string) (*tenantStores, error) {
+		opening <- struct{}{}
+
+		select {
+		case <-release:
+			return &tenantStores{blogs: newMemoryStore()}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, []string{"acme"}, time.Minute)
+
+	// the first call gives up while the tenant is being opened
+	ctx, cancel := context.WithCancel(withTenant(context.Background(), "acme"))
+	first := make(chan error, 1)
+	go func() {
+		_, err := registry.get(ctx)
+		first <- err
+	}()
+
+	<-opening
+	cancel()
+
+	if err := <-first; err != context.Canceled {
+		t.Errorf("get of the cancelled call = %v, want %v", err, context.Canceled)
+	}
+
+	second := make(chan *tenantStores, 1)
+	go func() {
+		stores, err := registry.get(withTenant(context.Background(), "acme"))
+		if err != nil {
+			t.Errorf("get after the cancelled call failed: %v", err)
+		}
+		second <- stores
+	}()
+
+	close(release)
+
+	if stores := <-second; stores == nil {
+		t.Error("get after the cancelled call got no stores")
+	}
+	if len(opening) != 0 {
+		t.Errorf("acme opened %v times, want 1", 1+len(opening))
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The tenant stores implement the store interfaces by handing every call to
+// the store of the tenant of its context. Handlers only ever see these, so no
+// call can reach the data of another tenant.
+
+type tenantBlogStore struct {
+	registry *tenantRegistry
+}
+
+func (t tenantBlogStore) store(ctx context.Context) (BlogStore, error) {
+	stores, err := t.registry.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.blogs, nil
+}
+
+func (t tenantBlogStore) Create(ctx context.Context, blog BlogItem) (BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return store.Create(ctx, blog)
+}
+
+func (t tenantBlogStore) CreateMany(ctx context.Context, blogs []BlogItem, atomic bool) ([]error, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return make([]error, len(blogs)), err
+	}
+
+	return store.CreateMany(ctx, blogs, atomic)
+}
+
+func (t tenantBlogStore) Get(ctx context.Context, id primitive.ObjectID) (BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return store.Get(ctx, id)
+}
+
+func (t tenantBlogStore) GetBySlug(ctx context.Context, slug string) (BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return store.GetBySlug(ctx, slug)
+}
+
+func (t tenantBlogStore) GetMany(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.GetMany(ctx, ids)
+}
+
+func (t tenantBlogStore) Update(ctx context.Context, id primitive.ObjectID, update BlogUpdate) (UpdateResult, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	return store.Update(ctx, id, update)
+}
+
+func (t tenantBlogStore) Delete(ctx context.Context, id primitive.ObjectID, revision *int64, deleteTime time.Time) (BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return store.Delete(ctx, id, revision, deleteTime)
+}
+
+func (t tenantBlogStore) DeleteMany(ctx context.Context, ids []primitive.ObjectID, deleteTime time.Time, atomic bool) (map[primitive.ObjectID]BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.DeleteMany(ctx, ids, deleteTime, atomic)
+}
+
+func (t tenantBlogStore) Undelete(ctx context.Context, id primitive.ObjectID) (BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogItem{}, err
+	}
+
+	return store.Undelete(ctx, id)
+}
+
+func (t tenantBlogStore) ListPurgeable(ctx context.Context, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListPurgeable(ctx, deletedBefore)
+}
+
+func (t tenantBlogStore) Purge(ctx context.Context, ids []primitive.ObjectID, deletedBefore time.Time) ([]primitive.ObjectID, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Purge(ctx, ids, deletedBefore)
+}
+
+func (t tenantBlogStore) List(ctx context.Context, query ListQuery, fn func(BlogItem) error) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.List(ctx, query, fn)
+}
+
+func (t tenantBlogStore) Search(ctx context.Context, query string, viewer primitive.ObjectID, limit int64) ([]SearchHit, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Search(ctx, query, viewer, limit)
+}
+
+func (t tenantBlogStore) ListScheduled(ctx context.Context, until time.Time) ([]BlogItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListScheduled(ctx, until)
+}
+
+func (t tenantBlogStore) ListTags(ctx context.Context, viewer primitive.ObjectID, limit int64) ([]TagCount, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListTags(ctx, viewer, limit)
+}
+
+func (t tenantBlogStore) Watch(ctx context.Context, resumeToken string, viewer primitive.ObjectID, fn func(BlogEvent) error) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.Watch(ctx, resumeToken, viewer, fn)
+}
+
+func (t tenantBlogStore) AddRevision(ctx context.Context, revision BlogRevisionItem) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.AddRevision(ctx, revision)
+}
+
+func (t tenantBlogStore) GetRevision(ctx context.Context, blogID primitive.ObjectID, revision int64) (BlogRevisionItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return BlogRevisionItem{}, err
+	}
+
+	return store.GetRevision(ctx, blogID, revision)
+}
+
+func (t tenantBlogStore) ListRevisions(ctx context.Context, blogID primitive.ObjectID, before int64, limit int64) ([]BlogRevisionItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListRevisions(ctx, blogID, before, limit)
+}
+
+type tenantCommentStore struct {
+	registry *tenantRegistry
+}
+
+func (t tenantCommentStore) store(ctx context.Context) (CommentStore, error) {
+	stores, err := t.registry.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.comments, nil
+}
+
+func (t tenantCommentStore) CreateComment(ctx context.Context, comment CommentItem) (CommentItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return store.CreateComment(ctx, comment)
+}
+
+func (t tenantCommentStore) GetComment(ctx context.Context, blogID, id primitive.ObjectID) (CommentItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return store.GetComment(ctx, blogID, id)
+}
+
+func (t tenantCommentStore) ListComments(ctx context.Context, blogID, parentID, after primitive.ObjectID, limit int64) ([]CommentItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListComments(ctx, blogID, parentID, after, limit)
+}
+
+func (t tenantCommentStore) UpdateComment(ctx context.Context, blogID, id primitive.ObjectID, content string, updateTime time.Time) (CommentItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return CommentItem{}, err
+	}
+
+	return store.UpdateComment(ctx, blogID, id, content, updateTime)
+}
+
+func (t tenantCommentStore) DeleteComment(ctx context.Context, blogID, id primitive.ObjectID) (int64, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return store.DeleteComment(ctx, blogID, id)
+}
+
+func (t tenantCommentStore) DeleteBlogComments(ctx context.Context, blogIDs []primitive.ObjectID) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.DeleteBlogComments(ctx, blogIDs)
+}
+
+type tenantAuthorStore struct {
+	registry *tenantRegistry
+}
+
+func (t tenantAuthorStore) store(ctx context.Context) (AuthorStore, error) {
+	stores, err := t.registry.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.authors, nil
+}
+
+func (t tenantAuthorStore) CreateAuthor(ctx context.Context, author AuthorItem) (AuthorItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return store.CreateAuthor(ctx, author)
+}
+
+func (t tenantAuthorStore) GetAuthor(ctx context.Context, id primitive.ObjectID) (AuthorItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return store.GetAuthor(ctx, id)
+}
+
+func (t tenantAuthorStore) ListAuthors(ctx context.Context, after primitive.ObjectID, limit int64) ([]AuthorItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListAuthors(ctx, after, limit)
+}
+
+func (t tenantAuthorStore) UpdateAuthor(ctx context.Context, id primitive.ObjectID, author AuthorItem, fields []string) (AuthorItem, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return AuthorItem{}, err
+	}
+
+	return store.UpdateAuthor(ctx, id, author, fields)
+}
+
+type tenantAttachmentStore struct {
+	registry *tenantRegistry
+}
+
+func (t tenantAttachmentStore) store(ctx context.Context) (AttachmentStore, error) {
+	stores, err := t.registry.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.attachments, nil
+}
+
+func (t tenantAttachmentStore) Put(ctx context.Context, blogID, id primitive.ObjectID, filename string, r io.Reader) (int64, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return store.Put(ctx, blogID, id, filename, r)
+}
+
+func (t tenantAttachmentStore) Open(ctx context.Context, blogID, id primitive.ObjectID) (io.ReadCloser, error) {
+	store, err := t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Open(ctx, blogID, id)
+}
+
+func (t tenantAttachmentStore) Delete(ctx context.Context, blogID, id primitive.ObjectID) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.Delete(ctx, blogID, id)
+}
+
+func (t tenantAttachmentStore) DeleteBlogAttachments(ctx context.Context, blogIDs []primitive.ObjectID) error {
+	store, err := t.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.DeleteBlogAttachments(ctx, blogIDs)
+}
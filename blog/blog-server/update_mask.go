@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// mutableFields are the blog fields clients may list in an update mask.
+var mutableFields = []string{"author_id", "title", "content", "content_format", "tags"}
+
+// updateFields returns the fields of blog an UpdateBlog call overwrites. With
+// an update mask these are exactly its paths, without one every non-empty
+// field is written.
+func updateFields(blog *blogpb.Blog, mask *fieldmaskpb.FieldMask) ([]string, error) {
+	if len(mask.GetPaths()) == 0 {
+		var fields []string
+
+		if blog.GetAuthorId() != "" {
+			fields = append(fields, "author_id")
+		}
+
+		if blog.GetTitle() != "" {
+			fields = append(fields, "title")
+		}
+
+		if blog.GetContent() != "" {
+			fields = append(fields, "content")
+		}
+
+		if blog.GetContentFormat() != blogpb.Blog_CONTENT_FORMAT_UNSPECIFIED {
+			fields = append(fields, "content_format")
+		}
+
+		if len(blog.GetTags()) > 0 {
+			fields = append(fields, "tags")
+		}
+
+		return fields, nil
+	}
+
+	var fields []string
+
+	for _, path := range mask.GetPaths() {
+		if !containsString(mutableFields, path) {
+			return nil, invalidField("update_mask", "invalid update mask path: %q, expected one of %v", path, mutableFields)
+		}
+
+		if !containsString(fields, path) {
+			fields = append(fields, path)
+		}
+	}
+
+	return fields, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liridonrama/grpc-go-course/blog/blogpb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// invalidArgument returns an InvalidArgument error carrying the violations
+// in a BadRequest detail.
+func invalidArgument(violations ...*errdetails.BadRequest_FieldViolation) error {
+	descriptions := make([]string, len(violations))
+	for i, violation := range violations {
+		descriptions[i] = violation.GetField() + ": " + violation.GetDescription()
+	}
+
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(descriptions, "; "))
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// invalidField is invalidArgument for a single broken field.
+func invalidField(field, format string, args ...interface{}) error {
+	return invalidArgument(&errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// validateRequest checks req against the FieldRules of its fields and returns
+// an error listing every violation, nil if there is none.
+func validateRequest(req proto.Message) error {
+	v := &validator{}
+	v.message(req.ProtoReflect(), "")
+
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	return invalidArgument(v.violations...)
+}
+
+// validator collects the violations of the FieldRules in a request.
+type validator struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *validator) violate(field, format string, args ...interface{}) {
+	v.violations = append(v.violations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// message checks the fields of msg, whose paths start with prefix.
+func (v *validator) message(msg protoreflect.Message, prefix string) {
+	fields := msg.Descriptor().Fields()
+
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		rules, _ := proto.GetExtension(fd.Options(), blogpb.E_Rules).(*blogpb.FieldRules)
+		path := prefix + string(fd.Name())
+
+		switch {
+		case fd.IsMap():
+			continue
+		case fd.IsList():
+			list := msg.Get(fd).List()
+
+			if rules.GetMinItems() > 0 && list.Len() < int(rules.GetMinItems()) {
+				v.violate(path, "must contain at least %v items", rules.GetMinItems())
+			}
+
+			if rules.GetMaxItems() > 0 && list.Len() > int(rules.GetMaxItems()) {
+				v.violate(path, "must contain at most %v items", rules.GetMaxItems())
+			}
+
+			for j := 0; j < list.Len(); j++ {
+				v.value(fd, list.Get(j), rules, fmt.Sprintf("%v[%v]", path, j))
+			}
+		default:
+			if !isSet(msg, fd) {
+				if rules.GetRequired() {
+					v.violate(path, "is required")
+				}
+				continue
+			}
+
+			v.value(fd, msg.Get(fd), rules, path)
+		}
+	}
+}
+
+// value checks a single value of the field fd.
+func (v *validator) value(fd protoreflect.FieldDescriptor, value protoreflect.Value, rules *blogpb.FieldRules, path string) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		s := value.String()
+		length := utf8.RuneCountInString(s)
+
+		if rules.GetMinLen() > 0 && length < int(rules.GetMinLen()) {
+			v.violate(path, "must be at least %v characters long", rules.GetMinLen())
+		}
+
+		if rules.GetMaxLen() > 0 && length > int(rules.GetMaxLen()) {
+			v.violate(path, "must be at most %v characters long", rules.GetMaxLen())
+		}
+
+		if rules.GetObjectId() && s != "" && !primitive.IsValidObjectID(s) {
+			v.violate(path, "%q is not a objectid string", s)
+		}
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind, protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		if rules.GetNonNegative() && value.Int() < 0 {
+			v.violate(path, "must not be negative")
+		}
+	case protoreflect.MessageKind:
+		nested := value.Message()
+		nestedFields := nested.Descriptor().Fields()
+
+		for _, name := range rules.GetRequiredFields() {
+			nfd := nestedFields.ByName(protoreflect.Name(name))
+			if nfd != nil && !isSet(nested, nfd) {
+				v.violate(path+"."+name, "is required")
+			}
+		}
+
+		for _, name := range rules.GetUnsetFields() {
+			nfd := nestedFields.ByName(protoreflect.Name(name))
+			if nfd != nil && nested.Has(nfd) {
+				v.violate(path+"."+name, "must not be set")
+			}
+		}
+
+		v.message(nested, path+".")
+	}
+}
+
+// isSet reports whether fd is set in msg, not counting whitespace only
+// strings.
+func isSet(msg protoreflect.Message, fd protoreflect.FieldDescriptor) bool {
+	if fd.Kind() == protoreflect.StringKind && !fd.IsList() {
+		return strings.TrimSpace(msg.Get(fd).String()) != ""
+	}
+
+	return msg.Has(fd)
+}
+
+// validationUnaryInterceptor rejects requests breaking their FieldRules
+// before they reach the handler.
+func validationUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if msg, ok := req.(proto.Message); ok {
+		err := validateRequest(msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+// validationStreamInterceptor does the same for the single request of server
+// streaming calls. Client streams, i.e. ImportBlogs, validate every message
+// themselves, so a bad one does not end the whole stream.
+func validationStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if info.IsClientStream {
+		return handler(srv, ss)
+	}
+
+	return handler(srv, &validatingStream{ServerStream: ss})
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	if msg, ok := m.(proto.Message); ok {
+		return validateRequest(msg)
+	}
+
+	return nil
+}
@@ -20,9 +20,32 @@ const _ = grpc.SupportPackageIsVersion7
 type BlogServiceClient interface {
 	CreateBlog(ctx context.Context, in *CreateBlogRequest, opts ...grpc.CallOption) (*CreateBlogResponse, error)
 	ReadBlog(ctx context.Context, in *ReadBlogRequest, opts ...grpc.CallOption) (*ReadBlogResponse, error)
+	GetBlogBySlug(ctx context.Context, in *GetBlogBySlugRequest, opts ...grpc.CallOption) (*GetBlogBySlugResponse, error)
 	UpdateBlog(ctx context.Context, in *UpdateBlogRequest, opts ...grpc.CallOption) (*UpdateBlogResponse, error)
 	DeleteBlog(ctx context.Context, in *DeleteBlogRequest, opts ...grpc.CallOption) (*DeleteBlogResponse, error)
+	UndeleteBlog(ctx context.Context, in *UndeleteBlogRequest, opts ...grpc.CallOption) (*UndeleteBlogResponse, error)
+	RenderBlog(ctx context.Context, in *RenderBlogRequest, opts ...grpc.CallOption) (*RenderBlogResponse, error)
+	PublishBlog(ctx context.Context, in *PublishBlogRequest, opts ...grpc.CallOption) (*PublishBlogResponse, error)
+	UnpublishBlog(ctx context.Context, in *UnpublishBlogRequest, opts ...grpc.CallOption) (*UnpublishBlogResponse, error)
+	BatchCreateBlogs(ctx context.Context, in *BatchCreateBlogsRequest, opts ...grpc.CallOption) (*BatchCreateBlogsResponse, error)
+	BatchGetBlogs(ctx context.Context, in *BatchGetBlogsRequest, opts ...grpc.CallOption) (*BatchGetBlogsResponse, error)
+	BatchDeleteBlogs(ctx context.Context, in *BatchDeleteBlogsRequest, opts ...grpc.CallOption) (*BatchDeleteBlogsResponse, error)
+	ImportBlogs(ctx context.Context, opts ...grpc.CallOption) (BlogService_ImportBlogsClient, error)
+	ExportBlogs(ctx context.Context, in *ExportBlogsRequest, opts ...grpc.CallOption) (BlogService_ExportBlogsClient, error)
+	UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (BlogService_UploadAttachmentClient, error)
+	DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (BlogService_DownloadAttachmentClient, error)
 	ListBlog(ctx context.Context, in *ListBlogRequest, opts ...grpc.CallOption) (BlogService_ListBlogClient, error)
+	ListBlogPage(ctx context.Context, in *ListBlogRequest, opts ...grpc.CallOption) (*ListBlogPageResponse, error)
+	WatchBlogs(ctx context.Context, in *WatchBlogsRequest, opts ...grpc.CallOption) (BlogService_WatchBlogsClient, error)
+	SearchBlogs(ctx context.Context, in *SearchBlogsRequest, opts ...grpc.CallOption) (*SearchBlogsResponse, error)
+	ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error)
+	CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentResponse, error)
+	ListComments(ctx context.Context, in *ListCommentsRequest, opts ...grpc.CallOption) (*ListCommentsResponse, error)
+	UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*UpdateCommentResponse, error)
+	DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*DeleteCommentResponse, error)
+	ListBlogRevisions(ctx context.Context, in *ListBlogRevisionsRequest, opts ...grpc.CallOption) (*ListBlogRevisionsResponse, error)
+	GetBlogRevision(ctx context.Context, in *GetBlogRevisionRequest, opts ...grpc.CallOption) (*GetBlogRevisionResponse, error)
+	RollbackBlog(ctx context.Context, in *RollbackBlogRequest, opts ...grpc.CallOption) (*RollbackBlogResponse, error)
 }
 
 type blogServiceClient struct {
@@ -51,6 +74,15 @@ func (c *blogServiceClient) ReadBlog(ctx context.Context, in *ReadBlogRequest, o
 	return out, nil
 }
 
+func (c *blogServiceClient) GetBlogBySlug(ctx context.Context, in *GetBlogBySlugRequest, opts ...grpc.CallOption) (*GetBlogBySlugResponse, error) {
+	out := new(GetBlogBySlugResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/GetBlogBySlug", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *blogServiceClient) UpdateBlog(ctx context.Context, in *UpdateBlogRequest, opts ...grpc.CallOption) (*UpdateBlogResponse, error) {
 	out := new(UpdateBlogResponse)
 	err := c.cc.Invoke(ctx, "/blog.BlogService/UpdateBlog", in, out, opts...)
@@ -69,8 +101,203 @@ func (c *blogServiceClient) DeleteBlog(ctx context.Context, in *DeleteBlogReques
 	return out, nil
 }
 
+func (c *blogServiceClient) UndeleteBlog(ctx context.Context, in *UndeleteBlogRequest, opts ...grpc.CallOption) (*UndeleteBlogResponse, error) {
+	out := new(UndeleteBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/UndeleteBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) RenderBlog(ctx context.Context, in *RenderBlogRequest, opts ...grpc.CallOption) (*RenderBlogResponse, error) {
+	out := new(RenderBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/RenderBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) PublishBlog(ctx context.Context, in *PublishBlogRequest, opts ...grpc.CallOption) (*PublishBlogResponse, error) {
+	out := new(PublishBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/PublishBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) UnpublishBlog(ctx context.Context, in *UnpublishBlogRequest, opts ...grpc.CallOption) (*UnpublishBlogResponse, error) {
+	out := new(UnpublishBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/UnpublishBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) BatchCreateBlogs(ctx context.Context, in *BatchCreateBlogsRequest, opts ...grpc.CallOption) (*BatchCreateBlogsResponse, error) {
+	out := new(BatchCreateBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/BatchCreateBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) BatchGetBlogs(ctx context.Context, in *BatchGetBlogsRequest, opts ...grpc.CallOption) (*BatchGetBlogsResponse, error) {
+	out := new(BatchGetBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/BatchGetBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) BatchDeleteBlogs(ctx context.Context, in *BatchDeleteBlogsRequest, opts ...grpc.CallOption) (*BatchDeleteBlogsResponse, error) {
+	out := new(BatchDeleteBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/BatchDeleteBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) ImportBlogs(ctx context.Context, opts ...grpc.CallOption) (BlogService_ImportBlogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[0], "/blog.BlogService/ImportBlogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blogServiceImportBlogsClient{stream}
+	return x, nil
+}
+
+type BlogService_ImportBlogsClient interface {
+	Send(*ImportBlogsRequest) error
+	CloseAndRecv() (*ImportBlogsResponse, error)
+	grpc.ClientStream
+}
+
+type blogServiceImportBlogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *blogServiceImportBlogsClient) Send(m *ImportBlogsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blogServiceImportBlogsClient) CloseAndRecv() (*ImportBlogsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportBlogsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blogServiceClient) ExportBlogs(ctx context.Context, in *ExportBlogsRequest, opts ...grpc.CallOption) (BlogService_ExportBlogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[1], "/blog.BlogService/ExportBlogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blogServiceExportBlogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlogService_ExportBlogsClient interface {
+	Recv() (*ExportBlogsResponse, error)
+	grpc.ClientStream
+}
+
+type blogServiceExportBlogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *blogServiceExportBlogsClient) Recv() (*ExportBlogsResponse, error) {
+	m := new(ExportBlogsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blogServiceClient) UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (BlogService_UploadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[2], "/blog.BlogService/UploadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blogServiceUploadAttachmentClient{stream}
+	return x, nil
+}
+
+type BlogService_UploadAttachmentClient interface {
+	Send(*UploadAttachmentRequest) error
+	CloseAndRecv() (*UploadAttachmentResponse, error)
+	grpc.ClientStream
+}
+
+type blogServiceUploadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *blogServiceUploadAttachmentClient) Send(m *UploadAttachmentRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blogServiceUploadAttachmentClient) CloseAndRecv() (*UploadAttachmentResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadAttachmentResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blogServiceClient) DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (BlogService_DownloadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[3], "/blog.BlogService/DownloadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blogServiceDownloadAttachmentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlogService_DownloadAttachmentClient interface {
+	Recv() (*DownloadAttachmentResponse, error)
+	grpc.ClientStream
+}
+
+type blogServiceDownloadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *blogServiceDownloadAttachmentClient) Recv() (*DownloadAttachmentResponse, error) {
+	m := new(DownloadAttachmentResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *blogServiceClient) ListBlog(ctx context.Context, in *ListBlogRequest, opts ...grpc.CallOption) (BlogService_ListBlogClient, error) {
-	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[0], "/blog.BlogService/ListBlog", opts...)
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[4], "/blog.BlogService/ListBlog", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,15 +328,160 @@ func (x *blogServiceListBlogClient) Recv() (*ListBlogResponse, error) {
 	return m, nil
 }
 
+func (c *blogServiceClient) ListBlogPage(ctx context.Context, in *ListBlogRequest, opts ...grpc.CallOption) (*ListBlogPageResponse, error) {
+	out := new(ListBlogPageResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ListBlogPage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) WatchBlogs(ctx context.Context, in *WatchBlogsRequest, opts ...grpc.CallOption) (BlogService_WatchBlogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlogService_ServiceDesc.Streams[5], "/blog.BlogService/WatchBlogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blogServiceWatchBlogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlogService_WatchBlogsClient interface {
+	Recv() (*BlogEvent, error)
+	grpc.ClientStream
+}
+
+type blogServiceWatchBlogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *blogServiceWatchBlogsClient) Recv() (*BlogEvent, error) {
+	m := new(BlogEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blogServiceClient) SearchBlogs(ctx context.Context, in *SearchBlogsRequest, opts ...grpc.CallOption) (*SearchBlogsResponse, error) {
+	out := new(SearchBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/SearchBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error) {
+	out := new(ListTagsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ListTags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentResponse, error) {
+	out := new(CreateCommentResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/CreateComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) ListComments(ctx context.Context, in *ListCommentsRequest, opts ...grpc.CallOption) (*ListCommentsResponse, error) {
+	out := new(ListCommentsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ListComments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*UpdateCommentResponse, error) {
+	out := new(UpdateCommentResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/UpdateComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*DeleteCommentResponse, error) {
+	out := new(DeleteCommentResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/DeleteComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) ListBlogRevisions(ctx context.Context, in *ListBlogRevisionsRequest, opts ...grpc.CallOption) (*ListBlogRevisionsResponse, error) {
+	out := new(ListBlogRevisionsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ListBlogRevisions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) GetBlogRevision(ctx context.Context, in *GetBlogRevisionRequest, opts ...grpc.CallOption) (*GetBlogRevisionResponse, error) {
+	out := new(GetBlogRevisionResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/GetBlogRevision", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) RollbackBlog(ctx context.Context, in *RollbackBlogRequest, opts ...grpc.CallOption) (*RollbackBlogResponse, error) {
+	out := new(RollbackBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/RollbackBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BlogServiceServer is the server API for BlogService service.
 // All implementations must embed UnimplementedBlogServiceServer
 // for forward compatibility
 type BlogServiceServer interface {
 	CreateBlog(context.Context, *CreateBlogRequest) (*CreateBlogResponse, error)
 	ReadBlog(context.Context, *ReadBlogRequest) (*ReadBlogResponse, error)
+	GetBlogBySlug(context.Context, *GetBlogBySlugRequest) (*GetBlogBySlugResponse, error)
 	UpdateBlog(context.Context, *UpdateBlogRequest) (*UpdateBlogResponse, error)
 	DeleteBlog(context.Context, *DeleteBlogRequest) (*DeleteBlogResponse, error)
+	UndeleteBlog(context.Context, *UndeleteBlogRequest) (*UndeleteBlogResponse, error)
+	RenderBlog(context.Context, *RenderBlogRequest) (*RenderBlogResponse, error)
+	PublishBlog(context.Context, *PublishBlogRequest) (*PublishBlogResponse, error)
+	UnpublishBlog(context.Context, *UnpublishBlogRequest) (*UnpublishBlogResponse, error)
+	BatchCreateBlogs(context.Context, *BatchCreateBlogsRequest) (*BatchCreateBlogsResponse, error)
+	BatchGetBlogs(context.Context, *BatchGetBlogsRequest) (*BatchGetBlogsResponse, error)
+	BatchDeleteBlogs(context.Context, *BatchDeleteBlogsRequest) (*BatchDeleteBlogsResponse, error)
+	ImportBlogs(BlogService_ImportBlogsServer) error
+	ExportBlogs(*ExportBlogsRequest, BlogService_ExportBlogsServer) error
+	UploadAttachment(BlogService_UploadAttachmentServer) error
+	DownloadAttachment(*DownloadAttachmentRequest, BlogService_DownloadAttachmentServer) error
 	ListBlog(*ListBlogRequest, BlogService_ListBlogServer) error
+	ListBlogPage(context.Context, *ListBlogRequest) (*ListBlogPageResponse, error)
+	WatchBlogs(*WatchBlogsRequest, BlogService_WatchBlogsServer) error
+	SearchBlogs(context.Context, *SearchBlogsRequest) (*SearchBlogsResponse, error)
+	ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error)
+	CreateComment(context.Context, *CreateCommentRequest) (*CreateCommentResponse, error)
+	ListComments(context.Context, *ListCommentsRequest) (*ListCommentsResponse, error)
+	UpdateComment(context.Context, *UpdateCommentRequest) (*UpdateCommentResponse, error)
+	DeleteComment(context.Context, *DeleteCommentRequest) (*DeleteCommentResponse, error)
+	ListBlogRevisions(context.Context, *ListBlogRevisionsRequest) (*ListBlogRevisionsResponse, error)
+	GetBlogRevision(context.Context, *GetBlogRevisionRequest) (*GetBlogRevisionResponse, error)
+	RollbackBlog(context.Context, *RollbackBlogRequest) (*RollbackBlogResponse, error)
 	mustEmbedUnimplementedBlogServiceServer()
 }
 
@@ -123,15 +495,84 @@ func (UnimplementedBlogServiceServer) CreateBlog(context.Context, *CreateBlogReq
 func (UnimplementedBlogServiceServer) ReadBlog(context.Context, *ReadBlogRequest) (*ReadBlogResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReadBlog not implemented")
 }
+func (UnimplementedBlogServiceServer) GetBlogBySlug(context.Context, *GetBlogBySlugRequest) (*GetBlogBySlugResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlogBySlug not implemented")
+}
 func (UnimplementedBlogServiceServer) UpdateBlog(context.Context, *UpdateBlogRequest) (*UpdateBlogResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateBlog not implemented")
 }
 func (UnimplementedBlogServiceServer) DeleteBlog(context.Context, *DeleteBlogRequest) (*DeleteBlogResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteBlog not implemented")
 }
+func (UnimplementedBlogServiceServer) UndeleteBlog(context.Context, *UndeleteBlogRequest) (*UndeleteBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndeleteBlog not implemented")
+}
+func (UnimplementedBlogServiceServer) RenderBlog(context.Context, *RenderBlogRequest) (*RenderBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenderBlog not implemented")
+}
+func (UnimplementedBlogServiceServer) PublishBlog(context.Context, *PublishBlogRequest) (*PublishBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishBlog not implemented")
+}
+func (UnimplementedBlogServiceServer) UnpublishBlog(context.Context, *UnpublishBlogRequest) (*UnpublishBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnpublishBlog not implemented")
+}
+func (UnimplementedBlogServiceServer) BatchCreateBlogs(context.Context, *BatchCreateBlogsRequest) (*BatchCreateBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreateBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) BatchGetBlogs(context.Context, *BatchGetBlogsRequest) (*BatchGetBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) BatchDeleteBlogs(context.Context, *BatchDeleteBlogsRequest) (*BatchDeleteBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDeleteBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) ImportBlogs(BlogService_ImportBlogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) ExportBlogs(*ExportBlogsRequest, BlogService_ExportBlogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) UploadAttachment(BlogService_UploadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadAttachment not implemented")
+}
+func (UnimplementedBlogServiceServer) DownloadAttachment(*DownloadAttachmentRequest, BlogService_DownloadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadAttachment not implemented")
+}
 func (UnimplementedBlogServiceServer) ListBlog(*ListBlogRequest, BlogService_ListBlogServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListBlog not implemented")
 }
+func (UnimplementedBlogServiceServer) ListBlogPage(context.Context, *ListBlogRequest) (*ListBlogPageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBlogPage not implemented")
+}
+func (UnimplementedBlogServiceServer) WatchBlogs(*WatchBlogsRequest, BlogService_WatchBlogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) SearchBlogs(context.Context, *SearchBlogsRequest) (*SearchBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchBlogs not implemented")
+}
+func (UnimplementedBlogServiceServer) ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTags not implemented")
+}
+func (UnimplementedBlogServiceServer) CreateComment(context.Context, *CreateCommentRequest) (*CreateCommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateComment not implemented")
+}
+func (UnimplementedBlogServiceServer) ListComments(context.Context, *ListCommentsRequest) (*ListCommentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListComments not implemented")
+}
+func (UnimplementedBlogServiceServer) UpdateComment(context.Context, *UpdateCommentRequest) (*UpdateCommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateComment not implemented")
+}
+func (UnimplementedBlogServiceServer) DeleteComment(context.Context, *DeleteCommentRequest) (*DeleteCommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteComment not implemented")
+}
+func (UnimplementedBlogServiceServer) ListBlogRevisions(context.Context, *ListBlogRevisionsRequest) (*ListBlogRevisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBlogRevisions not implemented")
+}
+func (UnimplementedBlogServiceServer) GetBlogRevision(context.Context, *GetBlogRevisionRequest) (*GetBlogRevisionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlogRevision not implemented")
+}
+func (UnimplementedBlogServiceServer) RollbackBlog(context.Context, *RollbackBlogRequest) (*RollbackBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackBlog not implemented")
+}
 func (UnimplementedBlogServiceServer) mustEmbedUnimplementedBlogServiceServer() {}
 
 // UnsafeBlogServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -181,26 +622,44 @@ func _BlogService_ReadBlog_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BlogService_UpdateBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(UpdateBlogRequest)
+func _BlogService_GetBlogBySlug_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlogBySlugRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BlogServiceServer).UpdateBlog(ctx, in)
+		return srv.(BlogServiceServer).GetBlogBySlug(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/blog.BlogService/UpdateBlog",
+		FullMethod: "/blog.BlogService/GetBlogBySlug",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BlogServiceServer).UpdateBlog(ctx, req.(*UpdateBlogRequest))
+		return srv.(BlogServiceServer).GetBlogBySlug(ctx, req.(*GetBlogBySlugRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BlogService_DeleteBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(DeleteBlogRequest)
+func _BlogService_UpdateBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).UpdateBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/UpdateBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).UpdateBlog(ctx, req.(*UpdateBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_DeleteBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBlogRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -217,6 +676,226 @@ func _BlogService_DeleteBlog_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BlogService_UndeleteBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).UndeleteBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/UndeleteBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).UndeleteBlog(ctx, req.(*UndeleteBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_RenderBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenderBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).RenderBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/RenderBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).RenderBlog(ctx, req.(*RenderBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_PublishBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).PublishBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/PublishBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).PublishBlog(ctx, req.(*PublishBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_UnpublishBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnpublishBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).UnpublishBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/UnpublishBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).UnpublishBlog(ctx, req.(*UnpublishBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_BatchCreateBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCreateBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).BatchCreateBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/BatchCreateBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).BatchCreateBlogs(ctx, req.(*BatchCreateBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_BatchGetBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).BatchGetBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/BatchGetBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).BatchGetBlogs(ctx, req.(*BatchGetBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_BatchDeleteBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).BatchDeleteBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/BatchDeleteBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).BatchDeleteBlogs(ctx, req.(*BatchDeleteBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_ImportBlogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlogServiceServer).ImportBlogs(&blogServiceImportBlogsServer{stream})
+}
+
+type BlogService_ImportBlogsServer interface {
+	SendAndClose(*ImportBlogsResponse) error
+	Recv() (*ImportBlogsRequest, error)
+	grpc.ServerStream
+}
+
+type blogServiceImportBlogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *blogServiceImportBlogsServer) SendAndClose(m *ImportBlogsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blogServiceImportBlogsServer) Recv() (*ImportBlogsRequest, error) {
+	m := new(ImportBlogsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlogService_ExportBlogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportBlogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlogServiceServer).ExportBlogs(m, &blogServiceExportBlogsServer{stream})
+}
+
+type BlogService_ExportBlogsServer interface {
+	Send(*ExportBlogsResponse) error
+	grpc.ServerStream
+}
+
+type blogServiceExportBlogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *blogServiceExportBlogsServer) Send(m *ExportBlogsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BlogService_UploadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlogServiceServer).UploadAttachment(&blogServiceUploadAttachmentServer{stream})
+}
+
+type BlogService_UploadAttachmentServer interface {
+	SendAndClose(*UploadAttachmentResponse) error
+	Recv() (*UploadAttachmentRequest, error)
+	grpc.ServerStream
+}
+
+type blogServiceUploadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *blogServiceUploadAttachmentServer) SendAndClose(m *UploadAttachmentResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blogServiceUploadAttachmentServer) Recv() (*UploadAttachmentRequest, error) {
+	m := new(UploadAttachmentRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlogService_DownloadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadAttachmentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlogServiceServer).DownloadAttachment(m, &blogServiceDownloadAttachmentServer{stream})
+}
+
+type BlogService_DownloadAttachmentServer interface {
+	Send(*DownloadAttachmentResponse) error
+	grpc.ServerStream
+}
+
+type blogServiceDownloadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *blogServiceDownloadAttachmentServer) Send(m *DownloadAttachmentResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _BlogService_ListBlog_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(ListBlogRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -238,6 +917,207 @@ func (x *blogServiceListBlogServer) Send(m *ListBlogResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _BlogService_ListBlogPage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ListBlogPage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ListBlogPage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ListBlogPage(ctx, req.(*ListBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_WatchBlogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBlogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlogServiceServer).WatchBlogs(m, &blogServiceWatchBlogsServer{stream})
+}
+
+type BlogService_WatchBlogsServer interface {
+	Send(*BlogEvent) error
+	grpc.ServerStream
+}
+
+type blogServiceWatchBlogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *blogServiceWatchBlogsServer) Send(m *BlogEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BlogService_SearchBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).SearchBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/SearchBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).SearchBlogs(ctx, req.(*SearchBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_ListTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ListTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ListTags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ListTags(ctx, req.(*ListTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_CreateComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).CreateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/CreateComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).CreateComment(ctx, req.(*CreateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_ListComments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCommentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ListComments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ListComments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ListComments(ctx, req.(*ListCommentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_UpdateComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).UpdateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/UpdateComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).UpdateComment(ctx, req.(*UpdateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_DeleteComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).DeleteComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/DeleteComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).DeleteComment(ctx, req.(*DeleteCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_ListBlogRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBlogRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ListBlogRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ListBlogRevisions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ListBlogRevisions(ctx, req.(*ListBlogRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_GetBlogRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlogRevisionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).GetBlogRevision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/GetBlogRevision",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).GetBlogRevision(ctx, req.(*GetBlogRevisionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_RollbackBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).RollbackBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/RollbackBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).RollbackBlog(ctx, req.(*RollbackBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BlogService_ServiceDesc is the grpc.ServiceDesc for BlogService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -253,6 +1133,10 @@ var BlogService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ReadBlog",
 			Handler:    _BlogService_ReadBlog_Handler,
 		},
+		{
+			MethodName: "GetBlogBySlug",
+			Handler:    _BlogService_GetBlogBySlug_Handler,
+		},
 		{
 			MethodName: "UpdateBlog",
 			Handler:    _BlogService_UpdateBlog_Handler,
@@ -261,13 +1145,300 @@ var BlogService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteBlog",
 			Handler:    _BlogService_DeleteBlog_Handler,
 		},
+		{
+			MethodName: "UndeleteBlog",
+			Handler:    _BlogService_UndeleteBlog_Handler,
+		},
+		{
+			MethodName: "RenderBlog",
+			Handler:    _BlogService_RenderBlog_Handler,
+		},
+		{
+			MethodName: "PublishBlog",
+			Handler:    _BlogService_PublishBlog_Handler,
+		},
+		{
+			MethodName: "UnpublishBlog",
+			Handler:    _BlogService_UnpublishBlog_Handler,
+		},
+		{
+			MethodName: "BatchCreateBlogs",
+			Handler:    _BlogService_BatchCreateBlogs_Handler,
+		},
+		{
+			MethodName: "BatchGetBlogs",
+			Handler:    _BlogService_BatchGetBlogs_Handler,
+		},
+		{
+			MethodName: "BatchDeleteBlogs",
+			Handler:    _BlogService_BatchDeleteBlogs_Handler,
+		},
+		{
+			MethodName: "ListBlogPage",
+			Handler:    _BlogService_ListBlogPage_Handler,
+		},
+		{
+			MethodName: "SearchBlogs",
+			Handler:    _BlogService_SearchBlogs_Handler,
+		},
+		{
+			MethodName: "ListTags",
+			Handler:    _BlogService_ListTags_Handler,
+		},
+		{
+			MethodName: "CreateComment",
+			Handler:    _BlogService_CreateComment_Handler,
+		},
+		{
+			MethodName: "ListComments",
+			Handler:    _BlogService_ListComments_Handler,
+		},
+		{
+			MethodName: "UpdateComment",
+			Handler:    _BlogService_UpdateComment_Handler,
+		},
+		{
+			MethodName: "DeleteComment",
+			Handler:    _BlogService_DeleteComment_Handler,
+		},
+		{
+			MethodName: "ListBlogRevisions",
+			Handler:    _BlogService_ListBlogRevisions_Handler,
+		},
+		{
+			MethodName: "GetBlogRevision",
+			Handler:    _BlogService_GetBlogRevision_Handler,
+		},
+		{
+			MethodName: "RollbackBlog",
+			Handler:    _BlogService_RollbackBlog_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ImportBlogs",
+			Handler:       _BlogService_ImportBlogs_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ExportBlogs",
+			Handler:       _BlogService_ExportBlogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "UploadAttachment",
+			Handler:       _BlogService_UploadAttachment_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadAttachment",
+			Handler:       _BlogService_DownloadAttachment_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "ListBlog",
 			Handler:       _BlogService_ListBlog_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchBlogs",
+			Handler:       _BlogService_WatchBlogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "blogpb/blog.proto",
+}
+
+// AuthorServiceClient is the client API for AuthorService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AuthorServiceClient interface {
+	CreateAuthor(ctx context.Context, in *CreateAuthorRequest, opts ...grpc.CallOption) (*CreateAuthorResponse, error)
+	GetAuthor(ctx context.Context, in *GetAuthorRequest, opts ...grpc.CallOption) (*GetAuthorResponse, error)
+	ListAuthors(ctx context.Context, in *ListAuthorsRequest, opts ...grpc.CallOption) (*ListAuthorsResponse, error)
+	UpdateAuthor(ctx context.Context, in *UpdateAuthorRequest, opts ...grpc.CallOption) (*UpdateAuthorResponse, error)
+}
+
+type authorServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuthorServiceClient(cc grpc.ClientConnInterface) AuthorServiceClient {
+	return &authorServiceClient{cc}
+}
+
+func (c *authorServiceClient) CreateAuthor(ctx context.Context, in *CreateAuthorRequest, opts ...grpc.CallOption) (*CreateAuthorResponse, error) {
+	out := new(CreateAuthorResponse)
+	err := c.cc.Invoke(ctx, "/blog.AuthorService/CreateAuthor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorServiceClient) GetAuthor(ctx context.Context, in *GetAuthorRequest, opts ...grpc.CallOption) (*GetAuthorResponse, error) {
+	out := new(GetAuthorResponse)
+	err := c.cc.Invoke(ctx, "/blog.AuthorService/GetAuthor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorServiceClient) ListAuthors(ctx context.Context, in *ListAuthorsRequest, opts ...grpc.CallOption) (*ListAuthorsResponse, error) {
+	out := new(ListAuthorsResponse)
+	err := c.cc.Invoke(ctx, "/blog.AuthorService/ListAuthors", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorServiceClient) UpdateAuthor(ctx context.Context, in *UpdateAuthorRequest, opts ...grpc.CallOption) (*UpdateAuthorResponse, error) {
+	out := new(UpdateAuthorResponse)
+	err := c.cc.Invoke(ctx, "/blog.AuthorService/UpdateAuthor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthorServiceServer is the server API for AuthorService service.
+// All implementations must embed UnimplementedAuthorServiceServer
+// for forward compatibility
+type AuthorServiceServer interface {
+	CreateAuthor(context.Context, *CreateAuthorRequest) (*CreateAuthorResponse, error)
+	GetAuthor(context.Context, *GetAuthorRequest) (*GetAuthorResponse, error)
+	ListAuthors(context.Context, *ListAuthorsRequest) (*ListAuthorsResponse, error)
+	UpdateAuthor(context.Context, *UpdateAuthorRequest) (*UpdateAuthorResponse, error)
+	mustEmbedUnimplementedAuthorServiceServer()
+}
+
+// UnimplementedAuthorServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAuthorServiceServer struct {
+}
+
+func (UnimplementedAuthorServiceServer) CreateAuthor(context.Context, *CreateAuthorRequest) (*CreateAuthorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAuthor not implemented")
+}
+func (UnimplementedAuthorServiceServer) GetAuthor(context.Context, *GetAuthorRequest) (*GetAuthorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuthor not implemented")
+}
+func (UnimplementedAuthorServiceServer) ListAuthors(context.Context, *ListAuthorsRequest) (*ListAuthorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuthors not implemented")
+}
+func (UnimplementedAuthorServiceServer) UpdateAuthor(context.Context, *UpdateAuthorRequest) (*UpdateAuthorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateAuthor not implemented")
+}
+func (UnimplementedAuthorServiceServer) mustEmbedUnimplementedAuthorServiceServer() {}
+
+// UnsafeAuthorServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AuthorServiceServer will
+// result in compilation errors.
+type UnsafeAuthorServiceServer interface {
+	mustEmbedUnimplementedAuthorServiceServer()
+}
+
+func RegisterAuthorServiceServer(s grpc.ServiceRegistrar, srv AuthorServiceServer) {
+	s.RegisterService(&AuthorService_ServiceDesc, srv)
+}
+
+func _AuthorService_CreateAuthor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAuthorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorServiceServer).CreateAuthor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.AuthorService/CreateAuthor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorServiceServer).CreateAuthor(ctx, req.(*CreateAuthorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthorService_GetAuthor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAuthorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorServiceServer).GetAuthor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.AuthorService/GetAuthor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorServiceServer).GetAuthor(ctx, req.(*GetAuthorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthorService_ListAuthors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuthorsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorServiceServer).ListAuthors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.AuthorService/ListAuthors",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorServiceServer).ListAuthors(ctx, req.(*ListAuthorsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthorService_UpdateAuthor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateAuthorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorServiceServer).UpdateAuthor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.AuthorService/UpdateAuthor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorServiceServer).UpdateAuthor(ctx, req.(*UpdateAuthorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AuthorService_ServiceDesc is the grpc.ServiceDesc for AuthorService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AuthorService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "blog.AuthorService",
+	HandlerType: (*AuthorServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAuthor",
+			Handler:    _AuthorService_CreateAuthor_Handler,
+		},
+		{
+			MethodName: "GetAuthor",
+			Handler:    _AuthorService_GetAuthor_Handler,
+		},
+		{
+			MethodName: "ListAuthors",
+			Handler:    _AuthorService_ListAuthors_Handler,
+		},
+		{
+			MethodName: "UpdateAuthor",
+			Handler:    _AuthorService_UpdateAuthor_Handler,
+		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "blogpb/blog.proto",
 }
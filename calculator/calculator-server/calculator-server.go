@@ -6,10 +6,11 @@ import (
 	"io"
 	"log"
 	"math"
-	"net"
+	"os"
 	"time"
 
 	"github.com/liridonrama/grpc-go-course/calculator/calculatorpb"
+	"github.com/liridonrama/grpc-go-course/config"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
@@ -130,12 +131,29 @@ func (*server) SquareRoot(ctx context.Context, req *calculatorpb.SquareRootReque
 }
 
 func main() {
-	mux, err := net.Listen("tcp", ":6543")
+	cfg := config.Server{
+		Address: ":6543",
+	}
+
+	settings := config.NewSet("calculator-server", "CALCULATOR")
+	cfg.Add(settings)
+
+	err := settings.Parse(os.Args[1:])
+	if err != nil {
+		log.Fatal("invalid configuration: ", err)
+	}
+
+	mux, err := cfg.Listen()
 	if err != nil {
 		log.Fatal("failed to listen", err)
 	}
 
-	s := grpc.NewServer()
+	opts, err := cfg.Options()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := grpc.NewServer(opts...)
 
 	calculatorpb.RegisterCalculatorServiceServer(s, &server{})
 
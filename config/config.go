@@ -0,0 +1,214 @@
+// Package config loads the settings of the servers from command line flags,
+// environment variables and a YAML or JSON file.
+//
+// Every setting has a dotted name like "mongo.uri". It is set by the flag
+// -mongo-uri, the environment variable <PREFIX>_MONGO_URI and the key uri of
+// the mongo object of the file. Flags take precedence over the environment,
+// which takes precedence over the file, which takes precedence over the
+// defaults. The file is named by the -config flag or <PREFIX>_CONFIG.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Set is a set of settings, see the package documentation.
+type Set struct {
+	prefix string
+	flags  *flag.FlagSet
+	file   string
+	checks []func() error
+}
+
+// NewSet returns an empty set of settings for the program name, whose
+// environment variables start with prefix.
+func NewSet(name, prefix string) *Set {
+	s := &Set{
+		prefix: prefix,
+		flags:  flag.NewFlagSet(name, flag.ExitOnError),
+	}
+
+	s.flags.StringVar(&s.file, "config", "", "YAML or JSON file to read settings from, also "+s.envName("config"))
+
+	return s
+}
+
+func (s *Set) flagName(name string) string {
+	return strings.ReplaceAll(name, ".", "-")
+}
+
+func (s *Set) envName(name string) string {
+	return s.prefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// Var adds a setting whose value is kept in v. Its current value is the
+// default.
+func (s *Set) Var(v flag.Value, name, usage string) {
+	s.flags.Var(v, s.flagName(name), usage+", also "+s.envName(name))
+}
+
+// String adds a string setting, see Var.
+func (s *Set) String(p *string, name, usage string) {
+	s.flags.StringVar(p, s.flagName(name), *p, usage+", also "+s.envName(name))
+}
+
+// Int adds an integer setting, see Var.
+func (s *Set) Int(p *int, name, usage string) {
+	s.flags.IntVar(p, s.flagName(name), *p, usage+", also "+s.envName(name))
+}
+
+// Bool adds a boolean setting, see Var.
+func (s *Set) Bool(p *bool, name, usage string) {
+	s.flags.BoolVar(p, s.flagName(name), *p, usage+", also "+s.envName(name))
+}
+
+// Duration adds a duration setting, see Var.
+func (s *Set) Duration(p *time.Duration, name, usage string) {
+	s.flags.DurationVar(p, s.flagName(name), *p, usage+", also "+s.envName(name))
+}
+
+// Check adds a check Parse runs once the settings are set, to reject values
+// or combinations of them that are not valid.
+func (s *Set) Check(check func() error) {
+	s.checks = append(s.checks, check)
+}
+
+// Parse sets the settings from args, which does not include the program
+// name, the environment and the settings file, in that order of precedence,
+// and runs the checks.
+func (s *Set) Parse(args []string) error {
+	err := s.flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if s.flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", s.flags.Args())
+	}
+
+	set := make(map[string]bool)
+	s.flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if !set["config"] {
+		s.file = os.Getenv(s.envName("config"))
+	}
+
+	// keyed by flag name, so the file and the environment can not both set
+	// a setting
+	values := make(map[string]string)
+	var unknown []string
+
+	if s.file != "" {
+		fileValues, err := readFile(s.file)
+		if err != nil {
+			return err
+		}
+
+		for name, value := range fileValues {
+			f := s.flags.Lookup(s.flagName(name))
+			if f == nil || f.Name == "config" {
+				unknown = append(unknown, name)
+				continue
+			}
+
+			values[f.Name] = value
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown settings in %v: %v", s.file, strings.Join(unknown, ", "))
+	}
+
+	s.flags.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(s.envName(f.Name)); ok && f.Name != "config" {
+			values[f.Name] = value
+		}
+	})
+
+	for name, value := range values {
+		if set[name] {
+			continue
+		}
+
+		err = s.flags.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %v: %v", value, name, err)
+		}
+	}
+
+	for _, check := range s.checks {
+		err = check()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readFile reads the settings of a file into their dotted names. YAML being
+// a superset of JSON, both are read the same way.
+func readFile(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+
+	err = yaml.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading %v: %v", path, err)
+	}
+
+	values := make(map[string]string)
+
+	err = flatten(values, "", doc)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading %v: %v", path, err)
+	}
+
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, doc map[string]interface{}) error {
+	for key, value := range doc {
+		name := prefix + key
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			err := flatten(values, name+".", value)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				if _, ok := item.(map[string]interface{}); ok {
+					return fmt.Errorf("%v must be a list of plain values", name)
+				}
+
+				items[i] = fmt.Sprint(item)
+			}
+
+			values[name] = strings.Join(items, ",")
+		case nil:
+			return fmt.Errorf("%v has no value", name)
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
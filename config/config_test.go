@@ -0,0 +1,272 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// settings is a set of every kind of setting, with the defaults the tests
+// expect them to keep unless they are set.
+type settings struct {
+	Server
+	Name    string
+	Count   int
+	Timeout time.Duration
+	Tenants string
+}
+
+func newSettings(prefix string) (*Set, *settings) {
+	c := &settings{
+		Server:  Server{Address: ":6543"},
+		Name:    "default",
+		Count:   1,
+		Timeout: time.Second,
+	}
+
+	s := NewSet("test-server", prefix)
+	c.Server.Add(s)
+	s.String(&c.Name, "mongo.database", "name")
+	s.Int(&c.Count, "count", "count")
+	s.Duration(&c.Timeout, "mongo.connect-timeout", "timeout")
+	s.String(&c.Tenants, "tenants", "tenants")
+
+	return s, c
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	return path
+}
+
+func TestParsePrecedence(t *testing.T) {
+	file := "mongo:\n  database: file\ncount: 2\n"
+
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"default", "", nil, nil, "default"},
+		{"file over default", file, nil, nil, "file"},
+		{"env over file", file, map[string]string{"BLOG_MONGO_DATABASE": "env"}, nil, "env"},
+		{"flag over env", file, map[string]string{"BLOG_MONGO_DATABASE": "env"}, []string{"-mongo-database", "flag"}, "flag"},
+		{"flag over file", file, nil, []string{"-mongo-database=flag"}, "flag"},
+		{"flag over default", "", nil, []string{"-mongo-database", "flag"}, "flag"},
+		{"env over default", "", map[string]string{"BLOG_MONGO_DATABASE": "env"}, nil, "env"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+
+			s, c := newSettings("BLOG")
+
+			err := s.Parse(args)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			if c.Name != tt.want {
+				t.Errorf("mongo.database = %q, want %q", c.Name, tt.want)
+			}
+
+			// settings none of the layers set keep their value from below
+			wantCount := 1
+			if tt.file != "" {
+				wantCount = 2
+			}
+			if c.Count != wantCount {
+				t.Errorf("count = %v, want %v", c.Count, wantCount)
+			}
+			if c.Timeout != time.Second {
+				t.Errorf("mongo.connect-timeout = %v, want the default %v", c.Timeout, time.Second)
+			}
+		})
+	}
+}
+
+func TestParseEnvPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		env    string
+		other  string
+	}{
+		{"BLOG", "BLOG_MONGO_CONNECT_TIMEOUT", "GREET_MONGO_CONNECT_TIMEOUT"},
+		{"GREET", "GREET_MONGO_CONNECT_TIMEOUT", "CALCULATOR_MONGO_CONNECT_TIMEOUT"},
+		{"CALCULATOR", "CALCULATOR_MONGO_CONNECT_TIMEOUT", "BLOG_MONGO_CONNECT_TIMEOUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			t.Setenv(tt.env, "5s")
+			// the variables of other servers are left alone
+			t.Setenv(tt.other, "not a duration")
+
+			s, c := newSettings(tt.prefix)
+
+			err := s.Parse(nil)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			if c.Timeout != 5*time.Second {
+				t.Errorf("mongo.connect-timeout = %v, want %v", c.Timeout, 5*time.Second)
+			}
+		})
+	}
+}
+
+func TestParseConfigFromEnv(t *testing.T) {
+	t.Setenv("GREET_CONFIG", writeFile(t, "config.yaml", "count: 3\n"))
+
+	s, c := newSettings("GREET")
+
+	err := s.Parse(nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if c.Count != 3 {
+		t.Errorf("count = %v, want %v", c.Count, 3)
+	}
+
+	// the flag names another file than the environment
+	s, c = newSettings("GREET")
+
+	err = s.Parse([]string{"-config", writeFile(t, "other.yaml", "count: 4\n")})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if c.Count != 4 {
+		t.Errorf("count = %v, want %v", c.Count, 4)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	want := settings{
+		Server:  Server{Address: ":7000", TLS: true, CertFile: "server.crt", KeyFile: "server.pem"},
+		Name:    "blog",
+		Count:   4,
+		Timeout: 5 * time.Second,
+		Tenants: "acme,globex",
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "config.yaml", `
+address: ":7000"
+tls:
+  enabled: true
+  cert-file: server.crt
+  key-file: server.pem
+mongo:
+  database: blog
+  connect-timeout: 5s
+count: 4
+tenants: [acme, globex]
+`},
+		{"json", "config.json", `{
+	"address": ":7000",
+	"tls": {"enabled": true, "cert-file": "server.crt", "key-file": "server.pem"},
+	"mongo": {"database": "blog", "connect-timeout": "5s"},
+	"count": 4,
+	"tenants": ["acme", "globex"]
+}`},
+		{"dotted keys", "config.yaml", `
+address: ":7000"
+tls.enabled: true
+tls.cert-file: server.crt
+tls.key-file: server.pem
+mongo.database: blog
+mongo.connect-timeout: 5s
+count: 4
+tenants: acme,globex
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newSettings("BLOG")
+
+			err := s.Parse([]string{"-config", writeFile(t, tt.file, tt.content)})
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			if *c != want {
+				t.Errorf("settings = %+v, want %+v", *c, want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unexpected argument", "", nil, []string{"serve"}, "unexpected arguments: [serve]"},
+		{"unknown settings", "mongo:\n  uri: x\nport: 1\n", nil, nil, ".yaml: mongo.uri, port"},
+		{"config in the file", "config: other.yaml\n", nil, nil, ".yaml: config"},
+		{"list of objects", "tenants:\n  - id: acme\n", nil, nil, "tenants must be a list of plain values"},
+		{"no value", "count:\n", nil, nil, "count has no value"},
+		{"not yaml", "count: [1\n", nil, nil, "error while reading "},
+		{"invalid int in the file", "count: many\n", nil, nil, `invalid value "many" for count`},
+		{"invalid int in env", "", map[string]string{"BLOG_COUNT": "many"}, nil, `invalid value "many" for count`},
+		{"invalid duration in env", "", map[string]string{"BLOG_MONGO_CONNECT_TIMEOUT": "5"}, nil, `invalid value "5" for mongo-connect-timeout`},
+		{"invalid bool in env", "", map[string]string{"BLOG_TLS_ENABLED": "maybe"}, nil, `invalid value "maybe" for tls-enabled`},
+		{"missing file", "", map[string]string{"BLOG_CONFIG": "missing.yaml"}, nil, "missing.yaml"},
+		{"address without port", "", nil, []string{"-address", "localhost"}, `invalid address "localhost"`},
+		{"port out of range", "", map[string]string{"BLOG_ADDRESS": ":65536"}, nil, `invalid port in address ":65536"`},
+		{"port not a number", "address: ':http'\n", nil, nil, `invalid port in address ":http"`},
+		{"tls without files", "", map[string]string{"BLOG_TLS_ENABLED": "true"}, nil, "serving over tls needs a certificate and key file"},
+		{"tls without key", "", map[string]string{"BLOG_TLS_ENABLED": "true", "BLOG_TLS_CERT_FILE": "server.crt"}, nil, "serving over tls needs a certificate and key file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+
+			s, _ := newSettings("BLOG")
+
+			err := s.Parse(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
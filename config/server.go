@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Server holds the settings every server has.
+type Server struct {
+	// Address is the address the server listens on.
+	Address string
+	// TLS enables serving with the certificate in CertFile and its key in
+	// KeyFile.
+	TLS      bool
+	CertFile string
+	KeyFile  string
+}
+
+// Add adds the settings of c to s, with the current values of c as
+// defaults.
+func (c *Server) Add(s *Set) {
+	s.String(&c.Address, "address", "address to listen on")
+	s.Bool(&c.TLS, "tls.enabled", "serve over tls")
+	s.String(&c.CertFile, "tls.cert-file", "certificate to serve over tls with")
+	s.String(&c.KeyFile, "tls.key-file", "private key of the tls certificate")
+
+	s.Check(c.check)
+}
+
+func (c *Server) check() error {
+	_, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", c.Address, err)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port in address %q", c.Address)
+	}
+
+	if c.TLS && (c.CertFile == "" || c.KeyFile == "") {
+		return fmt.Errorf("serving over tls needs a certificate and key file")
+	}
+
+	return nil
+}
+
+// Listen listens on the address of the server.
+func (c *Server) Listen() (net.Listener, error) {
+	return net.Listen("tcp", c.Address)
+}
+
+// Options returns the grpc server options implementing the settings.
+func (c *Server) Options() ([]grpc.ServerOption, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+
+	creds, err := credentials.NewServerTLSFromFile(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading certificates: %v", err)
+	}
+
+	return []grpc.ServerOption{grpc.Creds(creds)}, nil
+}
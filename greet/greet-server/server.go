@@ -5,15 +5,14 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/liridonrama/grpc-go-course/config"
 	"github.com/liridonrama/grpc-go-course/greet/greetpb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 )
 
@@ -124,31 +123,35 @@ func (s *server) GreetWithDeadline(ctx context.Context, req *greetpb.GreetWithDe
 }
 
 func main() {
-	mux, err := net.Listen("tcp", ":6543")
-	if err != nil {
-		log.Fatalln("failed to listen", err)
+	cfg := config.Server{
+		Address:  ":6543",
+		CertFile: "ssl/server.crt",
+		KeyFile:  "ssl/server.pem",
 	}
 
-	var s *grpc.Server
+	// kept for deployments setting it before GREET_TLS_ENABLED existed
+	cfg.TLS, _ = strconv.ParseBool(os.Getenv("TLS_ENABLED"))
+
+	settings := config.NewSet("greet-server", "GREET")
+	cfg.Add(settings)
 
-	tls, err := strconv.ParseBool(os.Getenv("TLS_ENABLED"))
+	err := settings.Parse(os.Args[1:])
 	if err != nil {
-		tls = false
+		log.Fatalln("invalid configuration:", err)
 	}
 
-	if tls {
-		certFile := "ssl/server.crt"
-		keyFile := "ssl/server.pem"
-		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
-		if err != nil {
-			log.Fatalln("failed loading certificates", err)
-		}
+	mux, err := cfg.Listen()
+	if err != nil {
+		log.Fatalln("failed to listen", err)
+	}
 
-		s = grpc.NewServer(grpc.Creds(creds))
-	} else {
-		s = grpc.NewServer()
+	opts, err := cfg.Options()
+	if err != nil {
+		log.Fatalln(err)
 	}
 
+	s := grpc.NewServer(opts...)
+
 	greetpb.RegisterGreetServiceServer(s, &server{})
 
 	err = s.Serve(mux)